@@ -0,0 +1,75 @@
+package api
+
+import (
+	"go-chat/internals/middleware"
+	"go-chat/internals/store"
+	"go-chat/internals/utils"
+	"log"
+	"net/http"
+)
+
+type BlockHandler struct {
+	BlockStore store.BlockStore
+	UserStore  store.UserStore
+	Logger     *log.Logger
+}
+
+func NewBlockHandler(blockStore store.BlockStore, userStore store.UserStore, logger *log.Logger) *BlockHandler {
+	return &BlockHandler{
+		BlockStore: blockStore,
+		UserStore:  userStore,
+		Logger:     logger,
+	}
+}
+
+// HandleBlockUser stops the user in the URL from opening direct chats with
+// the caller, reaching them over WebSocket and seeing their presence.
+func (h *BlockHandler) HandleBlockUser(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	blockedID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return
+	}
+	blocked, err := h.UserStore.GetUserById(blockedID)
+	if err != nil {
+		h.Logger.Printf("Error:error while fetching user %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if blocked == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+
+	if err := h.BlockStore.BlockUser(r.Context(), user.ID, blockedID); err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"blocked": true})
+}
+
+func (h *BlockHandler) HandleUnblockUser(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	blockedID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return
+	}
+
+	if err := h.BlockStore.UnblockUser(r.Context(), user.ID, blockedID); err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"blocked": false})
+}
+
+func (h *BlockHandler) HandleGetBlockedUsers(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	blocked, err := h.BlockStore.GetBlockedUsers(r.Context(), user.ID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"blocked_users": blocked})
+}
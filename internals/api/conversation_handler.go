@@ -1,20 +1,169 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
+	"go-chat/internals/middleware"
 	"go-chat/internals/store"
+	"go-chat/internals/utils"
 	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
 )
 
 type ConversationHandler struct {
 	MessageStore      store.MessageStore
 	ConversationStore store.ConversationStore
+	UserStore         store.UserStore
+	Broadcaster       Broadcaster
 	Logger            *log.Logger
 }
 
-func NewConversationHandler(messageStore store.MessageStore, conversationStore store.ConversationStore, logger *log.Logger) *ConversationHandler {
+type createDirectConversationRequest struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+type createGroupConversationRequest struct {
+	Name           string      `json:"name"`
+	ParticipantIDs []uuid.UUID `json:"participant_ids"`
+}
+
+func NewConversationHandler(messageStore store.MessageStore, conversationStore store.ConversationStore, userStore store.UserStore, broadcaster Broadcaster, logger *log.Logger) *ConversationHandler {
 	return &ConversationHandler{
 		MessageStore:      messageStore,
 		ConversationStore: conversationStore,
+		UserStore:         userStore,
+		Broadcaster:       broadcaster,
 		Logger:            logger,
 	}
 }
+
+func (h *ConversationHandler) HandleCreateDirectConversation(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	var req createDirectConversationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == uuid.Nil {
+		h.Logger.Printf("Error:error while decoding %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "user_id is required"})
+		return
+	}
+
+	other, err := h.UserStore.GetUserById(req.UserID)
+	if err != nil {
+		h.Logger.Printf("Error:error while fetching user %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	if other == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+		return
+	}
+
+	conversation, err := h.ConversationStore.FindOrCreateDirectConversation(r.Context(), user.ID, other.ID)
+	if errors.Is(err, store.ErrSelfConversation) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, store.ErrUserBlocked) {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.Logger.Printf("Error:error while creating direct conversation %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"conversation": conversation})
+}
+
+func (h *ConversationHandler) HandleCreateGroupConversation(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	var req createGroupConversationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.Logger.Printf("Error:error while decoding %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request body"})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "name must be between 1 and 100 characters"})
+		return
+	}
+
+	for _, id := range req.ParticipantIDs {
+		participant, err := h.UserStore.GetUserById(id)
+		if err != nil {
+			h.Logger.Printf("Error:error while fetching user %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		if participant == nil {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found: " + id.String()})
+			return
+		}
+	}
+
+	conversation, err := h.ConversationStore.CreateGroupConversation(r.Context(), req.Name, user.ID, req.ParticipantIDs)
+	if errors.Is(err, store.ErrNoParticipants) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.Logger.Printf("Error:error while creating group conversation %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"conversation": conversation})
+}
+
+func (h *ConversationHandler) HandleGetConversations(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversations, err := h.ConversationStore.GetConversationsByUserID(r.Context(), user.ID)
+	if err != nil {
+		h.Logger.Printf("Error:error while fetching conversations %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"conversations": conversations})
+}
+
+func (h *ConversationHandler) HandleGetNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid conversation id"})
+		return
+	}
+
+	settings, err := h.ConversationStore.GetNotificationSettings(r.Context(), conversationID, user.ID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"settings": settings})
+}
+
+// HandleUpdateNotificationSettings replaces the caller's settings for a
+// conversation: notification_level is required and leaving out muted_until
+// unmutes it.
+func (h *ConversationHandler) HandleUpdateNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid conversation id"})
+		return
+	}
+	var req store.NotificationSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request body"})
+		return
+	}
+
+	settings, err := h.ConversationStore.UpdateNotificationSettings(r.Context(), conversationID, user.ID, req)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"settings": settings})
+}
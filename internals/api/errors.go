@@ -0,0 +1,64 @@
+package api
+
+import (
+	"errors"
+	"go-chat/internals/store"
+	"go-chat/internals/utils"
+	"log"
+	"net/http"
+)
+
+// storeErrorStatuses maps store errors that are the caller's fault to the
+// status they are reported with. Anything else is an internal error.
+var storeErrorStatuses = map[error]int{
+	store.ErrConversationNotFound: http.StatusNotFound,
+	store.ErrNotParticipant:       http.StatusForbidden,
+	store.ErrInvalidCursor:        http.StatusBadRequest,
+	store.ErrMessageNotFound:      http.StatusNotFound,
+	store.ErrNotMessageSender:     http.StatusForbidden,
+	store.ErrEditWindowExpired:    http.StatusForbidden,
+	store.ErrMessageDeleted:       http.StatusGone,
+	store.ErrInvalidDeleteScope:   http.StatusBadRequest,
+	store.ErrMessageTooLong:       http.StatusRequestEntityTooLarge,
+	store.ErrInvalidReaction:      http.StatusBadRequest,
+	store.ErrNotAdmin:             http.StatusForbidden,
+	store.ErrTooManyPins:          http.StatusConflict,
+	store.ErrNotPinned:            http.StatusNotFound,
+	store.ErrAlreadyPinned:        http.StatusConflict,
+	store.ErrSystemMessage:        http.StatusForbidden,
+	store.ErrNotGroup:             http.StatusBadRequest,
+	store.ErrAlreadyParticipant:   http.StatusConflict,
+	store.ErrLastAdmin:            http.StatusConflict,
+	store.ErrInvalidRole:          http.StatusBadRequest,
+	store.ErrNoChange:             http.StatusConflict,
+	store.ErrCannotRemoveSelf:     http.StatusBadRequest,
+	store.ErrInviteNotFound:       http.StatusNotFound,
+	store.ErrInviteExpired:        http.StatusGone,
+	store.ErrInviteRevoked:        http.StatusGone,
+	store.ErrInviteUsedUp:         http.StatusGone,
+	store.ErrJoinRequestNotFound:  http.StatusNotFound,
+	store.ErrJoinRequestPending:   http.StatusConflict,
+	store.ErrSelfBlock:            http.StatusBadRequest,
+	store.ErrUserBlocked:          http.StatusForbidden,
+	store.ErrUploadNotFound:       http.StatusNotFound,
+	// Offset mismatches are answered with 409 Conflict as the tus
+	// protocol asks.
+	store.ErrUploadSessionNotFound: http.StatusNotFound,
+	store.ErrUploadOffsetMismatch:  http.StatusConflict,
+	store.ErrUploadSessionBusy:     http.StatusLocked,
+	store.ErrUploadQuotaExceeded:   http.StatusTooManyRequests,
+
+	store.ErrInvalidNotificationLevel: http.StatusBadRequest,
+	store.ErrPushSubscriptionNotFound: http.StatusNotFound,
+}
+
+func writeStoreError(w http.ResponseWriter, logger *log.Logger, err error) {
+	for known, status := range storeErrorStatuses {
+		if errors.Is(err, known) {
+			utils.WriteJSON(w, status, utils.Envelope{"error": known.Error()})
+			return
+		}
+	}
+	logger.Printf("Error: %v", err)
+	utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+}
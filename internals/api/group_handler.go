@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"go-chat/internals/middleware"
+	"go-chat/internals/store"
+	"go-chat/internals/utils"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type addMembersRequest struct {
+	UserIDs []uuid.UUID `json:"user_ids"`
+}
+
+type setRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type renameGroupRequest struct {
+	Name string `json:"name"`
+}
+
+func (h *ConversationHandler) HandleGetMembers(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid conversation id"})
+		return
+	}
+	ok, err := h.ConversationStore.IsParticipant(r.Context(), conversationID, user.ID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	if !ok {
+		writeStoreError(w, h.Logger, store.ErrNotParticipant)
+		return
+	}
+
+	members, err := h.ConversationStore.GetConversationMembers(r.Context(), conversationID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"members": members})
+}
+
+func (h *ConversationHandler) HandleAddMembers(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid conversation id"})
+		return
+	}
+	var req addMembersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.UserIDs) == 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "user_ids is required"})
+		return
+	}
+	for _, id := range req.UserIDs {
+		member, err := h.UserStore.GetUserById(id)
+		if err != nil {
+			h.Logger.Printf("Error:error while fetching user %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		if member == nil {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found: " + id.String()})
+			return
+		}
+	}
+
+	change, err := h.ConversationStore.AddMembers(r.Context(), conversationID, user.ID, req.UserIDs)
+	h.finishGroupChange(w, r, change, err)
+}
+
+// HandleRemoveMember removes the member named in the URL. Members removing
+// themselves leave the group.
+func (h *ConversationHandler) HandleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, userID, ok := readMemberParams(w, r)
+	if !ok {
+		return
+	}
+
+	var change *store.GroupChange
+	var err error
+	if userID == user.ID {
+		change, err = h.ConversationStore.LeaveGroup(r.Context(), conversationID, user.ID)
+	} else {
+		change, err = h.ConversationStore.RemoveMember(r.Context(), conversationID, user.ID, userID)
+	}
+	h.finishGroupChange(w, r, change, err)
+}
+
+func (h *ConversationHandler) HandleSetMemberRole(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, userID, ok := readMemberParams(w, r)
+	if !ok {
+		return
+	}
+	var req setRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request body"})
+		return
+	}
+
+	change, err := h.ConversationStore.SetMemberRole(r.Context(), conversationID, user.ID, userID, req.Role)
+	h.finishGroupChange(w, r, change, err)
+}
+
+func (h *ConversationHandler) HandleRenameGroup(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid conversation id"})
+		return
+	}
+	var req renameGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request body"})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "name must be between 1 and 100 characters"})
+		return
+	}
+
+	change, err := h.ConversationStore.RenameGroup(r.Context(), conversationID, user.ID, req.Name)
+	h.finishGroupChange(w, r, change, err)
+}
+
+func (h *ConversationHandler) HandleLeaveGroup(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid conversation id"})
+		return
+	}
+
+	change, err := h.ConversationStore.LeaveGroup(r.Context(), conversationID, user.ID)
+	h.finishGroupChange(w, r, change, err)
+}
+
+// finishGroupChange reports the outcome of a group change and, when it
+// went through, tells the group about it.
+func (h *ConversationHandler) finishGroupChange(w http.ResponseWriter, r *http.Request, change *store.GroupChange, err error) {
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	if err := h.Broadcaster.BroadcastGroupChange(r.Context(), change); err != nil {
+		h.Logger.Printf("Error:error while broadcasting group change %v", err)
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"conversation": change.Conversation, "messages": change.Messages})
+}
+
+// readMemberParams reads the {id} and {userID} URL parameters.
+func readMemberParams(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	conversationID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid conversation id"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return conversationID, userID, true
+}
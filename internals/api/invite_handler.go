@@ -0,0 +1,180 @@
+package api
+
+import (
+	"encoding/json"
+	"go-chat/internals/middleware"
+	"go-chat/internals/store"
+	"go-chat/internals/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type InviteHandler struct {
+	InviteStore store.InviteStore
+	Broadcaster Broadcaster
+	Logger      *log.Logger
+}
+
+type createInviteRequest struct {
+	ExpiresAt        *time.Time `json:"expires_at"`
+	MaxUses          *int       `json:"max_uses"`
+	RequiresApproval bool       `json:"requires_approval"`
+}
+
+func NewInviteHandler(inviteStore store.InviteStore, broadcaster Broadcaster, logger *log.Logger) *InviteHandler {
+	return &InviteHandler{
+		InviteStore: inviteStore,
+		Broadcaster: broadcaster,
+		Logger:      logger,
+	}
+}
+
+// HandleCreateInvite mints an invite link for a group. expires_at and
+// max_uses are optional; without them the link works until revoked.
+func (h *InviteHandler) HandleCreateInvite(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid conversation id"})
+		return
+	}
+	var req createInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request body"})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "expires_at must be in the future"})
+		return
+	}
+	if req.MaxUses != nil && *req.MaxUses < 1 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "max_uses must be a positive integer"})
+		return
+	}
+
+	invite, err := h.InviteStore.CreateInvite(r.Context(), &store.Invite{
+		ConversationID:   conversationID,
+		CreatedBy:        &user.ID,
+		ExpiresAt:        req.ExpiresAt,
+		MaxUses:          req.MaxUses,
+		RequiresApproval: req.RequiresApproval,
+	})
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"invite": invite})
+}
+
+func (h *InviteHandler) HandleGetInvites(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid conversation id"})
+		return
+	}
+
+	invites, err := h.InviteStore.GetInvites(r.Context(), conversationID, user.ID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"invites": invites})
+}
+
+func (h *InviteHandler) HandleRevokeInvite(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid conversation id"})
+		return
+	}
+	inviteID, err := uuid.Parse(chi.URLParam(r, "inviteID"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid invite id"})
+		return
+	}
+
+	invite, err := h.InviteStore.RevokeInvite(r.Context(), conversationID, inviteID, user.ID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"invite": invite})
+}
+
+// HandleJoin joins the group behind an invite code. Invites that require
+// approval answer 202 with the pending join request instead.
+func (h *InviteHandler) HandleJoin(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	code := chi.URLParam(r, "code")
+
+	change, request, err := h.InviteStore.JoinWithInvite(r.Context(), code, user.ID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	if request != nil {
+		if err := h.Broadcaster.BroadcastJoinRequested(r.Context(), request); err != nil {
+			h.Logger.Printf("Error:error while broadcasting join request %v", err)
+		}
+		utils.WriteJSON(w, http.StatusAccepted, utils.Envelope{"join_request": request})
+		return
+	}
+	if err := h.Broadcaster.BroadcastGroupChange(r.Context(), change); err != nil {
+		h.Logger.Printf("Error:error while broadcasting group change %v", err)
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"conversation": change.Conversation})
+}
+
+func (h *InviteHandler) HandleGetJoinRequests(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid conversation id"})
+		return
+	}
+
+	requests, err := h.InviteStore.GetJoinRequests(r.Context(), conversationID, user.ID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"join_requests": requests})
+}
+
+func (h *InviteHandler) HandleApproveJoinRequest(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, userID, ok := readMemberParams(w, r)
+	if !ok {
+		return
+	}
+
+	change, err := h.InviteStore.ApproveJoinRequest(r.Context(), conversationID, user.ID, userID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	if err := h.Broadcaster.BroadcastGroupChange(r.Context(), change); err != nil {
+		h.Logger.Printf("Error:error while broadcasting group change %v", err)
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"conversation": change.Conversation, "messages": change.Messages})
+}
+
+func (h *InviteHandler) HandleRejectJoinRequest(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, userID, ok := readMemberParams(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.InviteStore.RejectJoinRequest(r.Context(), conversationID, user.ID, userID); err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "join request rejected"})
+}
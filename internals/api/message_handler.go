@@ -1,20 +1,328 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-chat/internals/middleware"
 	"go-chat/internals/store"
+	"go-chat/internals/utils"
+	"go-chat/internals/websockets"
 	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultMessagePageSize = 50
+	maxMessagePageSize     = 100
 )
 
+var errInvalidLimit = errors.New("limit must be a positive integer")
+
+// Broadcaster pushes real-time events to the participants of a
+// conversation.
+type Broadcaster interface {
+	BroadcastToConversation(ctx context.Context, conversationID uuid.UUID, eventType string, payload any) error
+	BroadcastMessageEdited(ctx context.Context, msg *store.Message) error
+	BroadcastMessageDeleted(ctx context.Context, msg *store.Message, userID uuid.UUID, scope store.DeleteScope) error
+	BroadcastReactionUpdated(ctx context.Context, msg *store.Message, userID uuid.UUID, emoji string, action string) error
+	BroadcastPinUpdated(ctx context.Context, msg *store.Message, userID uuid.UUID, action string) error
+	BroadcastGroupChange(ctx context.Context, change *store.GroupChange) error
+	BroadcastJoinRequested(ctx context.Context, request *store.JoinRequest) error
+}
+
 type MessageHandler struct {
 	MessageStore      store.MessageStore
 	ConversationStore store.ConversationStore
+	Broadcaster       Broadcaster
 	Logger            *log.Logger
 }
 
-func NewMessageHandler(messageStore store.MessageStore, conversationStore store.ConversationStore, logger *log.Logger) *MessageHandler {
+type editMessageRequest struct {
+	Content string `json:"content"`
+}
+
+type reactionRequest struct {
+	Emoji string `json:"emoji"`
+}
+
+func NewMessageHandler(messageStore store.MessageStore, conversationStore store.ConversationStore, broadcaster Broadcaster, logger *log.Logger) *MessageHandler {
 	return &MessageHandler{
 		MessageStore:      messageStore,
 		ConversationStore: conversationStore,
+		Broadcaster:       broadcaster,
 		Logger:            logger,
 	}
 }
+
+func (h *MessageHandler) HandleGetConversationMessages(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid conversation id"})
+		return
+	}
+
+	limit, err := readLimit(r, defaultMessagePageSize, maxMessagePageSize)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	direction, cursor, err := readPageCursor(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if !h.requireParticipant(w, r, conversationID, user.ID) {
+		return
+	}
+
+	// Ask for one extra row to learn whether another page exists.
+	messages, err := h.MessageStore.GetMessagesByConversationID(r.Context(), conversationID, user.ID, limit+1, cursor, direction)
+	if err != nil {
+		h.Logger.Printf("Error:error while fetching messages %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, pageEnvelope(messages, limit, direction))
+}
+
+func (h *MessageHandler) HandleEditMessage(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	messageID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid message id"})
+		return
+	}
+	var req editMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Content == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "content is required"})
+		return
+	}
+
+	msg, err := h.MessageStore.EditMessage(r.Context(), messageID, user.ID, req.Content)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	if err := h.Broadcaster.BroadcastMessageEdited(r.Context(), msg); err != nil {
+		h.Logger.Printf("Error:error while broadcasting edit %v", err)
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": msg})
+}
+
+// HandleDeleteMessage deletes a message for the caller (?scope=me, the
+// default) or, for its sender, for everyone (?scope=everyone).
+func (h *MessageHandler) HandleDeleteMessage(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	messageID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid message id"})
+		return
+	}
+	scope := store.DeleteScope(r.URL.Query().Get("scope"))
+	if scope == "" {
+		scope = store.DeleteForMe
+	}
+
+	msg, err := h.MessageStore.DeleteMessage(r.Context(), messageID, user.ID, scope)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	if err := h.Broadcaster.BroadcastMessageDeleted(r.Context(), msg, user.ID, scope); err != nil {
+		h.Logger.Printf("Error:error while broadcasting delete %v", err)
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": msg})
+}
+
+func (h *MessageHandler) HandleAddReaction(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	messageID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid message id"})
+		return
+	}
+	var req reactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request body"})
+		return
+	}
+
+	msg, err := h.MessageStore.AddReaction(r.Context(), messageID, user.ID, req.Emoji)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	if err := h.Broadcaster.BroadcastReactionUpdated(r.Context(), msg, user.ID, req.Emoji, websockets.ReactionAdded); err != nil {
+		h.Logger.Printf("Error:error while broadcasting reaction %v", err)
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"reactions": msg.Reactions})
+}
+
+func (h *MessageHandler) HandleRemoveReaction(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	messageID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid message id"})
+		return
+	}
+	emoji, err := url.PathUnescape(chi.URLParam(r, "emoji"))
+	if err != nil || emoji == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid emoji"})
+		return
+	}
+
+	msg, err := h.MessageStore.RemoveReaction(r.Context(), messageID, user.ID, emoji)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	if err := h.Broadcaster.BroadcastReactionUpdated(r.Context(), msg, user.ID, emoji, websockets.ReactionRemoved); err != nil {
+		h.Logger.Printf("Error:error while broadcasting reaction %v", err)
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"reactions": msg.Reactions})
+}
+
+func (h *MessageHandler) HandleGetMessageRevisions(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	messageID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid message id"})
+		return
+	}
+
+	msg, err := h.MessageStore.GetVisibleMessageByID(r.Context(), messageID, user.ID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	if !h.requireParticipant(w, r, msg.ConversationID, user.ID) {
+		return
+	}
+
+	revisions, err := h.MessageStore.GetMessageRevisions(r.Context(), messageID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"revisions": revisions})
+}
+
+// requireParticipant writes a 403 and returns false unless userID is an
+// active participant of the conversation.
+func (h *MessageHandler) requireParticipant(w http.ResponseWriter, r *http.Request, conversationID, userID uuid.UUID) bool {
+	ok, err := h.ConversationStore.IsParticipant(r.Context(), conversationID, userID)
+	if err != nil {
+		h.Logger.Printf("Error:error while checking participant %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return false
+	}
+	if !ok {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not a participant of this conversation"})
+		return false
+	}
+	return true
+}
+
+// readParamUUID reads the {id} URL parameter as a UUID.
+func readParamUUID(r *http.Request) (uuid.UUID, error) {
+	paramID, err := utils.ReadParamIdStr(r)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.Parse(paramID)
+}
+
+// readLimit parses the optional ?limit= query parameter.
+func readLimit(r *http.Request, fallback, max int) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return fallback, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return 0, errInvalidLimit
+	}
+	if limit > max {
+		limit = max
+	}
+	return limit, nil
+}
+
+var errConflictingCursors = errors.New("only one of before and after may be set")
+
+// readPageCursor parses the optional ?before= or ?after= cursor. Without
+// either, paging starts from the newest message.
+func readPageCursor(r *http.Request) (store.PageDirection, *store.MessageCursor, error) {
+	query := r.URL.Query()
+	before, after := query.Get("before"), query.Get("after")
+	if before != "" && after != "" {
+		return "", nil, errConflictingCursors
+	}
+	direction, rawCursor := store.PageBefore, before
+	if after != "" {
+		direction, rawCursor = store.PageAfter, after
+	}
+	if rawCursor == "" {
+		return direction, nil, nil
+	}
+	cursor, err := store.DecodeMessageCursor(rawCursor)
+	if err != nil {
+		return "", nil, err
+	}
+	return direction, cursor, nil
+}
+
+// pageEnvelope trims a page fetched with limit+1 rows back to limit and
+// builds the response, with cursors for the pages on either side.
+func pageEnvelope(messages []store.Message, limit int, direction store.PageDirection) utils.Envelope {
+	hasMore := len(messages) > limit
+	if hasMore {
+		if direction == store.PageAfter {
+			messages = messages[:limit]
+		} else {
+			messages = messages[1:]
+		}
+	}
+
+	resp := utils.Envelope{"messages": messages, "has_more": hasMore}
+	if len(messages) > 0 {
+		resp["before_cursor"] = store.CursorForMessage(&messages[0]).Encode()
+		resp["after_cursor"] = store.CursorForMessage(&messages[len(messages)-1]).Encode()
+	}
+	return resp
+}
+
+// HandleGetUnreadCounts returns how many messages of a conversation the
+// caller hasn't read, and how many of those mention them.
+func (h *MessageHandler) HandleGetUnreadCounts(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid conversation id"})
+		return
+	}
+	if !h.requireParticipant(w, r, conversationID, user.ID) {
+		return
+	}
+
+	unread, err := h.MessageStore.GetUnreadMessagesCount(r.Context(), user.ID, conversationID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	mentions, err := h.MessageStore.GetUnreadMentionCount(r.Context(), user.ID, conversationID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"unread_count": unread, "unread_mention_count": mentions})
+}
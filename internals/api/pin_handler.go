@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"go-chat/internals/middleware"
+	"go-chat/internals/utils"
+	"go-chat/internals/websockets"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type pinRequest struct {
+	MessageID uuid.UUID `json:"message_id"`
+}
+
+func (h *MessageHandler) HandleGetPins(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid conversation id"})
+		return
+	}
+	if !h.requireParticipant(w, r, conversationID, user.ID) {
+		return
+	}
+
+	pins, err := h.MessageStore.GetPinnedMessages(r.Context(), conversationID, user.ID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"pins": pins})
+}
+
+func (h *MessageHandler) HandlePinMessage(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid conversation id"})
+		return
+	}
+	var req pinRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MessageID == uuid.Nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "message_id is required"})
+		return
+	}
+
+	pin, err := h.MessageStore.PinMessage(r.Context(), conversationID, req.MessageID, user.ID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	if err := h.Broadcaster.BroadcastPinUpdated(r.Context(), &pin.Message, user.ID, websockets.MessagePinned); err != nil {
+		h.Logger.Printf("Error:error while broadcasting pin %v", err)
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"pin": pin})
+}
+
+func (h *MessageHandler) HandleUnpinMessage(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	conversationID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid conversation id"})
+		return
+	}
+	messageID, err := uuid.Parse(chi.URLParam(r, "messageID"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid message id"})
+		return
+	}
+
+	msg, err := h.MessageStore.UnpinMessage(r.Context(), conversationID, messageID, user.ID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	if err := h.Broadcaster.BroadcastPinUpdated(r.Context(), msg, user.ID, websockets.MessageUnpinned); err != nil {
+		h.Logger.Printf("Error:error while broadcasting pin %v", err)
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": msg})
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"go-chat/internals/middleware"
+	"go-chat/internals/store"
+	"go-chat/internals/utils"
+	"go-chat/internals/websockets"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type PresenceProvider interface {
+	GetPresence(ctx context.Context, userID uuid.UUID) (*websockets.Presence, error)
+}
+
+type PresenceHandler struct {
+	Presence          PresenceProvider
+	ConversationStore store.ConversationStore
+	UserStore         store.UserStore
+	BlockStore        store.BlockStore
+	Logger            *log.Logger
+}
+
+func NewPresenceHandler(presence PresenceProvider, conversationStore store.ConversationStore, userStore store.UserStore, blockStore store.BlockStore, logger *log.Logger) *PresenceHandler {
+	return &PresenceHandler{
+		Presence:          presence,
+		ConversationStore: conversationStore,
+		UserStore:         userStore,
+		BlockStore:        blockStore,
+		Logger:            logger,
+	}
+}
+
+func (h *PresenceHandler) HandleGetPresence(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	paramID, err := utils.ReadParamIdStr(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	userID, err := uuid.Parse(paramID)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid user id"})
+		return
+	}
+
+	// Presence is only visible to yourself and people you share a
+	// conversation with, unless they blocked you.
+	if userID != user.ID {
+		peers, err := h.ConversationStore.GetConversationPeers(r.Context(), user.ID)
+		if err != nil {
+			h.Logger.Printf("Error:error while fetching peers %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+			return
+		}
+		shared := false
+		for _, id := range peers {
+			if id == userID {
+				shared = true
+				break
+			}
+		}
+		if shared {
+			blocked, err := h.BlockStore.HasBlocked(r.Context(), userID, user.ID)
+			if err != nil {
+				h.Logger.Printf("Error:error while checking blocks %v", err)
+				utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+				return
+			}
+			shared = !blocked
+		}
+		if !shared {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "user not found"})
+			return
+		}
+	}
+
+	presence, err := h.Presence.GetPresence(r.Context(), userID)
+	if err != nil {
+		h.Logger.Printf("Error:error while fetching presence %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"presence": presence})
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"go-chat/internals/middleware"
+	"go-chat/internals/push"
+	"go-chat/internals/store"
+	"go-chat/internals/utils"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type PushHandler struct {
+	PushStore store.PushStore
+	// VAPIDPublicKey is empty when push notifications are not configured.
+	VAPIDPublicKey string
+	// Endpoints decides which push services subscriptions may point at.
+	Endpoints push.EndpointPolicy
+	Logger    *log.Logger
+}
+
+// pushSubscriptionRequest mirrors PushSubscription.toJSON() in browsers.
+type pushSubscriptionRequest struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+func NewPushHandler(pushStore store.PushStore, vapidPublicKey string, endpoints push.EndpointPolicy, logger *log.Logger) *PushHandler {
+	return &PushHandler{
+		PushStore:      pushStore,
+		VAPIDPublicKey: vapidPublicKey,
+		Endpoints:      endpoints,
+		Logger:         logger,
+	}
+}
+
+// HandleGetVAPIDPublicKey returns the applicationServerKey browsers need to
+// subscribe.
+func (h *PushHandler) HandleGetVAPIDPublicKey(w http.ResponseWriter, r *http.Request) {
+	if h.VAPIDPublicKey == "" {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "push notifications are not enabled"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"public_key": h.VAPIDPublicKey})
+}
+
+// HandleCreateSubscription registers the caller's device for push
+// notifications.
+func (h *PushHandler) HandleCreateSubscription(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if h.VAPIDPublicKey == "" {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "push notifications are not enabled"})
+		return
+	}
+	var req pushSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request body"})
+		return
+	}
+	if err := h.Endpoints.Check(r.Context(), req.Endpoint); err != nil {
+		if errors.Is(err, push.ErrForbiddenEndpoint) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "endpoint is not a public push service"})
+			return
+		}
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "endpoint must be an https URL"})
+		return
+	}
+	if err := push.ValidateKeys(req.Keys.P256dh, req.Keys.Auth); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "keys.p256dh must be a P-256 public key and keys.auth a 16-byte secret, base64url-encoded"})
+		return
+	}
+
+	sub := &store.PushSubscription{
+		UserID:   user.ID,
+		Endpoint: req.Endpoint,
+		P256dh:   req.Keys.P256dh,
+		Auth:     req.Keys.Auth,
+	}
+	if userAgent := r.UserAgent(); userAgent != "" {
+		if len(userAgent) > 255 {
+			userAgent = userAgent[:255]
+		}
+		sub.UserAgent = &userAgent
+	}
+	sub, err := h.PushStore.SavePushSubscription(r.Context(), sub)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"subscription": sub})
+}
+
+func (h *PushHandler) HandleGetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	subs, err := h.PushStore.GetPushSubscriptions(r.Context(), []uuid.UUID{user.ID})
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"subscriptions": subs})
+}
+
+func (h *PushHandler) HandleDeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	subscriptionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid subscription id"})
+		return
+	}
+
+	if err := h.PushStore.DeletePushSubscription(r.Context(), subscriptionID, user.ID); err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"message": "push subscription deleted"})
+}
@@ -0,0 +1,416 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"go-chat/internals/middleware"
+	"go-chat/internals/store"
+	"go-chat/internals/utils"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Resumable uploads follow the tus 1.0.0 protocol (https://tus.io) with the
+// creation, termination and expiration extensions, so off-the-shelf tus
+// clients work against them. Once the last chunk arrives the file is
+// finalized like a regular upload, under the session's id, and can be sent
+// with a message.
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+
+	// resumableUploadTTL is how long a session may sit idle before it is
+	// considered abandoned.
+	resumableUploadTTL = 24 * time.Hour
+
+	expiredSessionBatch = 100
+)
+
+type ResumableUploadHandler struct {
+	Uploads    *UploadHandler
+	StagingDir string
+	MaxBytes   int64
+	// MaxSessions and MaxReservedBytes bound how many unfinished sessions
+	// a user may have open and how much staging space they may claim.
+	MaxSessions      int
+	MaxReservedBytes int64
+	Logger           *log.Logger
+}
+
+func NewResumableUploadHandler(uploads *UploadHandler, stagingDir string, maxBytes int64, maxSessions int, maxReservedBytes int64, logger *log.Logger) (*ResumableUploadHandler, error) {
+	if err := os.MkdirAll(stagingDir, 0o750); err != nil {
+		return nil, err
+	}
+	return &ResumableUploadHandler{
+		Uploads:          uploads,
+		StagingDir:       stagingDir,
+		MaxBytes:         maxBytes,
+		MaxSessions:      maxSessions,
+		MaxReservedBytes: maxReservedBytes,
+		Logger:           logger,
+	}, nil
+}
+
+// HandleOptions advertises what the server supports.
+func (h *ResumableUploadHandler) HandleOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.MaxBytes, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleCreate starts a session for an upload of Upload-Length bytes. The
+// file name may be given as "filename" in Upload-Metadata.
+func (h *ResumableUploadHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+	user := middleware.GetUser(r)
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 1 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Upload-Length must be a positive integer"})
+		return
+	}
+	if length > h.MaxBytes {
+		utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": errFileTooLarge.Error()})
+		return
+	}
+	metadata := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	fileName := metadata["filename"]
+	if fileName == "" {
+		fileName = metadata["name"]
+	}
+
+	session, err := h.Uploads.UploadStore.CreateUploadSession(r.Context(), &store.UploadSession{
+		UploaderID: user.ID,
+		FileName:   cleanFileName(fileName),
+		Length:     length,
+		ExpiresAt:  time.Now().Add(resumableUploadTTL),
+	}, h.MaxSessions, h.MaxReservedBytes)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	file, err := os.Create(h.stagingPath(session.ID))
+	if err != nil {
+		h.Logger.Printf("Error:error while creating staging file %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	file.Close()
+
+	w.Header().Set("Location", "/uploads/resumable/"+session.ID.String())
+	w.Header().Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"session": session})
+}
+
+// HandleHead tells a client where to resume from. Once a session has been
+// finalized it answers for the finished upload instead, so a client that
+// missed the last PATCH response learns it is done and where the file is.
+func (h *ResumableUploadHandler) HandleHead(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+	user := middleware.GetUser(r)
+	sessionID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": store.ErrUploadSessionNotFound.Error()})
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	session, err := h.Uploads.UploadStore.GetUploadSession(r.Context(), sessionID, user.ID)
+	if errors.Is(err, store.ErrUploadSessionNotFound) {
+		upload, uploadErr := h.Uploads.UploadStore.GetUpload(r.Context(), sessionID)
+		if uploadErr != nil && !errors.Is(uploadErr, store.ErrUploadNotFound) {
+			writeStoreError(w, h.Logger, uploadErr)
+			return
+		}
+		if upload == nil || upload.UploaderID != user.ID {
+			writeStoreError(w, h.Logger, err)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Size, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(upload.Size, 10))
+		setFinishedUpload(w, upload)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(session.Length, 10))
+	w.Header().Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandlePatch appends a chunk starting at Upload-Offset. Whatever part of
+// the chunk arrives before the connection drops is kept. When the last byte
+// is in, the file is finalized into an upload; like every successful PATCH
+// the answer is 204, with the upload's id and URL in headers.
+func (h *ResumableUploadHandler) HandlePatch(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		utils.WriteJSON(w, http.StatusUnsupportedMediaType, utils.Envelope{"error": "Content-Type must be application/offset+octet-stream"})
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Upload-Offset must be a non-negative integer"})
+		return
+	}
+
+	session, unlock, ok := h.lockSession(w, r)
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	if offset != session.Offset {
+		writeStoreError(w, h.Logger, store.ErrUploadOffsetMismatch)
+		return
+	}
+
+	written, writeErr := h.writeChunk(session, r.Body)
+	if written > 0 {
+		session, err = h.Uploads.UploadStore.AdvanceUploadSession(r.Context(), session.ID, offset, offset+written, time.Now().Add(resumableUploadTTL))
+		if err != nil {
+			writeStoreError(w, h.Logger, err)
+			return
+		}
+	}
+	if writeErr != nil {
+		h.Logger.Printf("Error:error while receiving chunk %v", writeErr)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+
+	if session.Complete() {
+		upload, err := h.finalize(r, session)
+		if err != nil {
+			h.Uploads.writeFinalizeError(w, err)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		setFinishedUpload(w, upload)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	w.Header().Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDelete abandons a session and its received bytes.
+func (h *ResumableUploadHandler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+	session, unlock, ok := h.lockSession(w, r)
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	if err := h.discard(r.Context(), session.ID); err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExpireSessions removes abandoned sessions and their staging files until
+// none are left. Sessions still being written to are left for a later run.
+func (h *ResumableUploadHandler) ExpireSessions(ctx context.Context) error {
+	for {
+		sessions, err := h.Uploads.UploadStore.ExpiredUploadSessions(ctx, expiredSessionBatch)
+		if err != nil {
+			return err
+		}
+		discarded := 0
+		for _, session := range sessions {
+			unlock, err := h.Uploads.UploadStore.LockUploadSession(ctx, session.ID)
+			if errors.Is(err, store.ErrUploadSessionBusy) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			err = h.discard(ctx, session.ID)
+			unlock()
+			if err != nil {
+				return err
+			}
+			discarded++
+		}
+		if len(sessions) < expiredSessionBatch || discarded == 0 {
+			return nil
+		}
+	}
+}
+
+// RunJanitor calls ExpireSessions, and removes the files of deleted
+// uploads from the blob store, every interval until ctx is done.
+func (h *ResumableUploadHandler) RunJanitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := h.ExpireSessions(ctx); err != nil {
+				h.Logger.Printf("Error:error while expiring upload sessions %v", err)
+			}
+			if err := h.Uploads.PurgeDeletedBlobs(ctx); err != nil {
+				h.Logger.Printf("Error:error while removing deleted files %v", err)
+			}
+		}
+	}
+}
+
+// writeChunk appends body to the session's staging file, never past the
+// announced length. Bytes left over from a chunk that was received but not
+// recorded are overwritten.
+func (h *ResumableUploadHandler) writeChunk(session *store.UploadSession, body io.Reader) (int64, error) {
+	file, err := os.OpenFile(h.stagingPath(session.ID), os.O_WRONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	if err := file.Truncate(session.Offset); err != nil {
+		file.Close()
+		return 0, err
+	}
+	if _, err := file.Seek(session.Offset, io.SeekStart); err != nil {
+		file.Close()
+		return 0, err
+	}
+	written, err := io.Copy(file, io.LimitReader(body, session.Length-session.Offset))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return written, err
+}
+
+// finalize turns a complete session into an upload. The session is gone
+// afterwards whether or not the file was accepted.
+func (h *ResumableUploadHandler) finalize(r *http.Request, session *store.UploadSession) (*store.Upload, error) {
+	defer func() {
+		if err := h.discard(context.Background(), session.ID); err != nil {
+			h.Logger.Printf("Error:error while removing upload session %v", err)
+		}
+	}()
+
+	file, err := os.Open(h.stagingPath(session.ID))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return h.Uploads.finalizeUpload(r, session.ID, session.UploaderID, session.FileName, file, session.Length)
+}
+
+func (h *ResumableUploadHandler) discard(ctx context.Context, sessionID uuid.UUID) error {
+	if err := h.Uploads.UploadStore.DeleteUploadSession(ctx, sessionID); err != nil {
+		return err
+	}
+	err := os.Remove(h.stagingPath(sessionID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// lockSession locks the {id} session of the current user against writers
+// on any instance and loads it afresh, so its offset cannot move until
+// unlock is called. It writes an error response and returns false if the
+// session is missing or busy.
+func (h *ResumableUploadHandler) lockSession(w http.ResponseWriter, r *http.Request) (*store.UploadSession, func(), bool) {
+	session, ok := h.readSession(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+	unlock, err := h.Uploads.UploadStore.LockUploadSession(r.Context(), session.ID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return nil, nil, false
+	}
+	session, ok = h.readSession(w, r)
+	if !ok {
+		unlock()
+		return nil, nil, false
+	}
+	return session, unlock, true
+}
+
+// readSession loads the {id} session of the current user, writing an error
+// response and returning false if there is none.
+func (h *ResumableUploadHandler) readSession(w http.ResponseWriter, r *http.Request) (*store.UploadSession, bool) {
+	user := middleware.GetUser(r)
+	sessionID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": store.ErrUploadSessionNotFound.Error()})
+		return nil, false
+	}
+	session, err := h.Uploads.UploadStore.GetUploadSession(r.Context(), sessionID, user.ID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return nil, false
+	}
+	return session, true
+}
+
+// setFinishedUpload points the client at the upload a session became.
+func setFinishedUpload(w http.ResponseWriter, upload *store.Upload) {
+	w.Header().Set("Upload-Id", upload.ID.String())
+	w.Header().Set("Content-Location", upload.URL())
+}
+
+// checkVersion sets the Tus-Resumable response header and refuses clients
+// speaking another protocol version.
+func (h *ResumableUploadHandler) checkVersion(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		utils.WriteJSON(w, http.StatusPreconditionFailed, utils.Envelope{"error": "unsupported Tus-Resumable version"})
+		return false
+	}
+	return true
+}
+
+func (h *ResumableUploadHandler) stagingPath(sessionID uuid.UUID) string {
+	return filepath.Join(h.StagingDir, sessionID.String())
+}
+
+// parseUploadMetadata decodes an Upload-Metadata header: comma-separated
+// pairs of a key and an optional base64 value. Malformed pairs are skipped.
+func parseUploadMetadata(header string) map[string]string {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		metadata[key] = string(value)
+	}
+	return metadata
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"errors"
+	"go-chat/internals/middleware"
+	"go-chat/internals/store"
+	"go-chat/internals/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultSearchPageSize = 20
+	maxSearchPageSize     = 100
+)
+
+var errEmptySearch = errors.New("q must contain search terms or has:attachment")
+
+// HandleSearchMessages searches the caller's conversations. Besides the
+// words in ?q=, which may include has:attachment, results can be narrowed
+// with ?conversation_id=, ?sender_id=, ?since= and ?until= (RFC 3339 times
+// or YYYY-MM-DD dates, until being exclusive). Results come newest first;
+// pass next_cursor as ?before= for the next page.
+func (h *MessageHandler) HandleSearchMessages(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	search, err := readMessageSearch(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	limit, err := readLimit(r, defaultSearchPageSize, maxSearchPageSize)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	var cursor *store.MessageCursor
+	if before := r.URL.Query().Get("before"); before != "" {
+		cursor, err = store.DecodeMessageCursor(before)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+	}
+
+	results, err := h.MessageStore.SearchMessages(r.Context(), user.ID, *search, limit+1, cursor)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	hasMore := len(results) > limit
+	if hasMore {
+		results = results[:limit]
+	}
+
+	resp := utils.Envelope{"results": results, "has_more": hasMore}
+	if hasMore {
+		resp["next_cursor"] = store.CursorForMessage(&results[len(results)-1].Message).Encode()
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+func readMessageSearch(r *http.Request) (*store.MessageSearch, error) {
+	query := r.URL.Query()
+	search := &store.MessageSearch{}
+
+	var terms []string
+	for _, term := range strings.Fields(query.Get("q")) {
+		if strings.EqualFold(term, "has:attachment") {
+			search.HasAttachment = true
+			continue
+		}
+		terms = append(terms, term)
+	}
+	search.Query = strings.Join(terms, " ")
+	if search.Query == "" && !search.HasAttachment {
+		return nil, errEmptySearch
+	}
+
+	var err error
+	if search.ConversationID, err = readOptionalUUID(query.Get("conversation_id")); err != nil {
+		return nil, errors.New("invalid conversation_id")
+	}
+	if search.SenderID, err = readOptionalUUID(query.Get("sender_id")); err != nil {
+		return nil, errors.New("invalid sender_id")
+	}
+	if search.Since, err = readSearchTime(query.Get("since"), false); err != nil {
+		return nil, errors.New("invalid since")
+	}
+	if search.Until, err = readSearchTime(query.Get("until"), true); err != nil {
+		return nil, errors.New("invalid until")
+	}
+	return search, nil
+}
+
+func readOptionalUUID(value string) (*uuid.UUID, error) {
+	if value == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// readSearchTime parses an RFC 3339 time or a date. A date used as an
+// exclusive upper bound stands for the end of that day.
+func readSearchTime(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"go-chat/internals/middleware"
+	"go-chat/internals/store"
+	"go-chat/internals/utils"
+	"log"
+	"net/http"
+)
+
+const (
+	defaultSyncPageSize = 200
+	maxSyncPageSize     = 500
+)
+
+type SyncHandler struct {
+	SyncStore store.SyncStore
+	Logger    *log.Logger
+}
+
+func NewSyncHandler(syncStore store.SyncStore, logger *log.Logger) *SyncHandler {
+	return &SyncHandler{
+		SyncStore: syncStore,
+		Logger:    logger,
+	}
+}
+
+// HandleSync returns every change in the caller's conversations since the
+// ?since= cursor. Without a cursor it only returns one for the current
+// state, to be used after loading history through the regular endpoints.
+func (h *SyncHandler) HandleSync(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	var since store.SyncCursor
+	if value := r.URL.Query().Get("since"); value != "" {
+		var err error
+		since, err = store.DecodeSyncCursor(value)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+	}
+	limit, err := readLimit(r, defaultSyncPageSize, maxSyncPageSize)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	result, err := h.SyncStore.GetChangesSince(r.Context(), user.ID, since, limit)
+	if err != nil {
+		h.Logger.Printf("Error:error while syncing %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"sync": result})
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"go-chat/internals/middleware"
+	"go-chat/internals/store"
+	"go-chat/internals/utils"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// HandleGetThread returns a thread's root message and a page of its
+// replies. The {id} may name the root or any reply in the thread.
+func (h *MessageHandler) HandleGetThread(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	limit, err := readLimit(r, defaultMessagePageSize, maxMessagePageSize)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+	direction, cursor, err := readPageCursor(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	root, ok := h.readThreadRoot(w, r, user.ID)
+	if !ok {
+		return
+	}
+
+	replies, err := h.MessageStore.GetThreadReplies(r.Context(), root.ID, user.ID, limit+1, cursor, direction)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	unread, err := h.MessageStore.GetThreadUnreadCount(r.Context(), root.ID, user.ID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+
+	resp := pageEnvelope(replies, limit, direction)
+	resp["root"] = root
+	resp["unread_count"] = unread
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *MessageHandler) HandleMarkThreadRead(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	root, ok := h.readThreadRoot(w, r, user.ID)
+	if !ok {
+		return
+	}
+	if err := h.MessageStore.MarkThreadRead(r.Context(), root.ID, user.ID); err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"root_message_id": root.ID, "unread_count": 0})
+}
+
+// readThreadRoot loads the root of the thread the {id} message belongs to,
+// writing an error response and returning false if it can't be read, is
+// hidden from the user or the user isn't a participant of its conversation.
+func (h *MessageHandler) readThreadRoot(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (*store.Message, bool) {
+	messageID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid message id"})
+		return nil, false
+	}
+
+	msg, err := h.MessageStore.GetVisibleMessageByID(r.Context(), messageID, userID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return nil, false
+	}
+	if msg.ThreadRootID != nil {
+		msg, err = h.MessageStore.GetVisibleMessageByID(r.Context(), *msg.ThreadRootID, userID)
+		if err != nil {
+			writeStoreError(w, h.Logger, err)
+			return nil, false
+		}
+	}
+	if !h.requireParticipant(w, r, msg.ConversationID, userID) {
+		return nil, false
+	}
+	return msg, true
+}
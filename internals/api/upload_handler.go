@@ -0,0 +1,352 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go-chat/internals/blob"
+	"go-chat/internals/media"
+	"go-chat/internals/middleware"
+	"go-chat/internals/store"
+	"go-chat/internals/utils"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	errFileTooLarge       = errors.New("file is too large")
+	errFileTypeNotAllowed = errors.New("file type is not allowed")
+	errInvalidImage       = errors.New("file is not a valid image")
+	errImageTooLarge      = errors.New("image dimensions are too large")
+)
+
+// multipartOverhead is allowed on top of the file size limit for the
+// multipart boundaries and headers around the file.
+const multipartOverhead = 1 << 20
+
+// blobDeletionBatch is how many deleted files are removed from the blob
+// store per query.
+const blobDeletionBatch = 100
+
+// allowedUploadTypes are the sniffed content types accepted for uploads.
+// Anything http.DetectContentType can't place is reported as
+// application/octet-stream and refused.
+var allowedUploadTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"video/mp4":       true,
+	"video/webm":      true,
+	"audio/mpeg":      true,
+	"audio/wave":      true,
+	"application/ogg": true,
+	"application/pdf": true,
+	"application/zip": true,
+	"text/plain":      true,
+}
+
+type UploadHandler struct {
+	UploadStore store.UploadStore
+	BlobStore   blob.BlobStore
+	MaxBytes    int64
+	Logger      *log.Logger
+}
+
+func NewUploadHandler(uploadStore store.UploadStore, blobStore blob.BlobStore, maxBytes int64, logger *log.Logger) *UploadHandler {
+	return &UploadHandler{
+		UploadStore: uploadStore,
+		BlobStore:   blobStore,
+		MaxBytes:    maxBytes,
+		Logger:      logger,
+	}
+}
+
+// HandleCreateUpload stores the multipart "file" field and returns the
+// upload, whose id can then be sent with a message.
+func (h *UploadHandler) HandleCreateUpload(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	r.Body = http.MaxBytesReader(w, r.Body, h.MaxBytes+multipartOverhead)
+	if err := r.ParseMultipartForm(multipartOverhead); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": errFileTooLarge.Error()})
+			return
+		}
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid multipart form"})
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "file is required"})
+		return
+	}
+	defer file.Close()
+	if header.Size > h.MaxBytes {
+		utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": errFileTooLarge.Error()})
+		return
+	}
+	if header.Size == 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "file is empty"})
+		return
+	}
+
+	upload, err := h.finalizeUpload(r, uuid.New(), user.ID, header.Filename, file, header.Size)
+	if err != nil {
+		h.writeFinalizeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"upload": upload, "url": upload.URL()})
+}
+
+// finalizeUpload checks a received file's type, stores it (cleaned up
+// first if it is an image) and records it as upload id.
+func (h *UploadHandler) finalizeUpload(r *http.Request, id, uploaderID uuid.UUID, fileName string, file io.ReadSeeker, size int64) (*store.Upload, error) {
+	mimeType, err := sniffContentType(file)
+	if err != nil {
+		return nil, err
+	}
+	if !allowedUploadTypes[mimeType] {
+		return nil, errFileTypeNotAllowed
+	}
+
+	upload := &store.Upload{
+		ID:         id,
+		UploaderID: uploaderID,
+		StorageKey: store.UploadKey(id),
+		FileName:   cleanFileName(fileName),
+		MimeType:   mimeType,
+		Size:       size,
+	}
+	if media.Supported(mimeType) {
+		// Images are decoded in memory, so they are held to the
+		// single-request limit even when sent in chunks.
+		if size > h.MaxBytes {
+			return nil, errFileTooLarge
+		}
+		err = h.storeImage(r, upload, file)
+	} else {
+		err = h.BlobStore.Put(r.Context(), upload.StorageKey, file, upload.Size, mimeType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return h.UploadStore.CreateUpload(r.Context(), upload)
+}
+
+// writeFinalizeError reports why finalizeUpload failed.
+func (h *UploadHandler) writeFinalizeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errFileTypeNotAllowed):
+		utils.WriteJSON(w, http.StatusUnsupportedMediaType, utils.Envelope{"error": err.Error()})
+	case errors.Is(err, errFileTooLarge):
+		utils.WriteJSON(w, http.StatusRequestEntityTooLarge, utils.Envelope{"error": err.Error()})
+	case errors.Is(err, errInvalidImage), errors.Is(err, errImageTooLarge):
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	default:
+		h.Logger.Printf("Error:error while storing upload %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	}
+}
+
+// storeImage stores the cleaned-up version of an uploaded image and its
+// thumbnails in place of the file as sent, recording their dimensions on
+// upload.
+func (h *UploadHandler) storeImage(r *http.Request, upload *store.Upload, file io.Reader) error {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	processed, err := media.Process(data, upload.MimeType)
+	if errors.Is(err, media.ErrTooLarge) {
+		return errImageTooLarge
+	}
+	if err != nil {
+		return errInvalidImage
+	}
+
+	original := processed.Original
+	if err := h.BlobStore.Put(r.Context(), upload.StorageKey, bytes.NewReader(original.Data), int64(len(original.Data)), original.MimeType); err != nil {
+		return err
+	}
+	upload.Size = int64(len(original.Data))
+	upload.Width = &original.Width
+	upload.Height = &original.Height
+
+	upload.Thumbnails = store.Thumbnails{}
+	for _, thumbnail := range processed.Thumbnails {
+		key := store.ThumbnailKey(upload.ID, thumbnail.Name)
+		if err := h.BlobStore.Put(r.Context(), key, bytes.NewReader(thumbnail.Data), int64(len(thumbnail.Data)), thumbnail.MimeType); err != nil {
+			return err
+		}
+		upload.Thumbnails = append(upload.Thumbnails, store.Thumbnail{
+			Name:     thumbnail.Name,
+			URL:      store.ThumbnailURL(upload.ID, thumbnail.Name),
+			Width:    thumbnail.Width,
+			Height:   thumbnail.Height,
+			MimeType: thumbnail.MimeType,
+		})
+	}
+	return nil
+}
+
+// HandleDownloadUpload streams an upload to its uploader or to a
+// participant of the conversation it was sent to.
+func (h *UploadHandler) HandleDownloadUpload(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	uploadID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid upload id"})
+		return
+	}
+
+	ok, err := h.UploadStore.CanDownloadUpload(r.Context(), uploadID, user.ID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	if !ok {
+		// Not telling outsiders whether the upload exists.
+		writeStoreError(w, h.Logger, store.ErrUploadNotFound)
+		return
+	}
+	upload, err := h.UploadStore.GetUpload(r.Context(), uploadID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+
+	h.serveBlob(w, r, upload.StorageKey, upload.MimeType, upload.Size, upload.FileName)
+}
+
+// HandleDownloadThumbnail streams one of an image upload's thumbnails, to
+// the same users who may download the image.
+func (h *UploadHandler) HandleDownloadThumbnail(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	uploadID, err := readParamUUID(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid upload id"})
+		return
+	}
+
+	ok, err := h.UploadStore.CanDownloadUpload(r.Context(), uploadID, user.ID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	if !ok {
+		writeStoreError(w, h.Logger, store.ErrUploadNotFound)
+		return
+	}
+	upload, err := h.UploadStore.GetUpload(r.Context(), uploadID)
+	if err != nil {
+		writeStoreError(w, h.Logger, err)
+		return
+	}
+	name := chi.URLParam(r, "size")
+	thumbnail, ok := upload.Thumbnails.Find(name)
+	if !ok {
+		writeStoreError(w, h.Logger, store.ErrUploadNotFound)
+		return
+	}
+
+	h.serveBlob(w, r, store.ThumbnailKey(upload.ID, name), thumbnail.MimeType, -1, name+"-"+upload.FileName)
+}
+
+// PurgeDeletedBlobs removes the files queued for deletion from the blob
+// store until none are left. Files that fail to delete stay queued for the
+// next run.
+func (h *UploadHandler) PurgeDeletedBlobs(ctx context.Context) error {
+	for {
+		keys, err := h.UploadStore.PendingBlobDeletions(ctx, blobDeletionBatch)
+		if err != nil {
+			return err
+		}
+		removed := make([]string, 0, len(keys))
+		for _, key := range keys {
+			if err := h.BlobStore.Delete(ctx, key); err != nil {
+				h.Logger.Printf("Error:error while deleting blob %s %v", key, err)
+				continue
+			}
+			removed = append(removed, key)
+		}
+		if len(removed) > 0 {
+			if err := h.UploadStore.ForgetBlobDeletions(ctx, removed); err != nil {
+				return err
+			}
+		}
+		if len(keys) < blobDeletionBatch || len(removed) == 0 {
+			return nil
+		}
+	}
+}
+
+// serveBlob copies a blob to the response, announcing its size unless it is
+// negative. Anything but images and video is sent as an attachment so
+// browsers never render it inline.
+func (h *UploadHandler) serveBlob(w http.ResponseWriter, r *http.Request, key, mimeType string, size int64, fileName string) {
+	body, err := h.BlobStore.Get(r.Context(), key)
+	if errors.Is(err, blob.ErrNotFound) {
+		writeStoreError(w, h.Logger, store.ErrUploadNotFound)
+		return
+	}
+	if err != nil {
+		h.Logger.Printf("Error:error while reading blob %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		return
+	}
+	defer body.Close()
+
+	disposition := "attachment"
+	if strings.HasPrefix(mimeType, "image/") || strings.HasPrefix(mimeType, "video/") {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", mimeType)
+	if size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": fileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, body); err != nil {
+		h.Logger.Printf("Error:error while sending blob %v", err)
+	}
+}
+
+// sniffContentType detects the type of file from its first bytes and
+// rewinds it. Parameters such as charset are dropped.
+func sniffContentType(file io.ReadSeeker) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	mimeType, _, _ := strings.Cut(http.DetectContentType(head[:n]), ";")
+	return mimeType, nil
+}
+
+// cleanFileName keeps only the base name a client sent, falling back to a
+// generic one.
+func cleanFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		return "file"
+	}
+	if len(name) > 255 {
+		name = strings.ToValidUTF8(name[len(name)-255:], "")
+	}
+	return name
+}
@@ -1,28 +1,46 @@
 package app
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"go-chat/internals/api"
+	"go-chat/internals/blob"
+	"go-chat/internals/config"
 	"go-chat/internals/email"
 	"go-chat/internals/middleware"
+	"go-chat/internals/pubsub"
+	"go-chat/internals/push"
 	"go-chat/internals/store"
 	"go-chat/internals/websockets"
 	"go-chat/migrations"
 	"log"
 	"net/http"
 	"os"
+	"time"
 )
 
+// uploadJanitorInterval is how often abandoned resumable uploads and the
+// files of deleted messages are cleaned up.
+const uploadJanitorInterval = 15 * time.Minute
+
 type Application struct {
 	Logger                     *log.Logger
 	DB                         *sql.DB
+	Broker                     pubsub.Broker
 	UserHandler                *api.UserHandler
 	EmailSender                *email.Sender
 	TokenHandler               *api.TokenHandler
 	AuthHandler                *api.AuthHandler
 	MessageHandler             *api.MessageHandler
 	ConversationHandler        *api.ConversationHandler
+	PresenceHandler            *api.PresenceHandler
+	SyncHandler                *api.SyncHandler
+	UploadHandler              *api.UploadHandler
+	ResumableUploadHandler     *api.ResumableUploadHandler
+	InviteHandler              *api.InviteHandler
+	BlockHandler               *api.BlockHandler
+	PushHandler                *api.PushHandler
 	UserMiddlewareHandler      middleware.UserMiddleware
 	WebsocketManager           *websockets.Manager
 	WebSocketMiddlewareHandler middleware.WebsocketMiddleware
@@ -40,22 +58,58 @@ func NewApplication() (*Application, error) {
 	}
 	emailCfg := email.LoadConfig()
 	emailSender := email.NewSender(emailCfg.Host, emailCfg.Port, emailCfg.Username, emailCfg.Password)
+	cfg := config.Load()
 	conversationStore := store.NewPostgresConversationStore(db)
-	messageStore := store.NewPostgresMessageStore(db)
+	messageStore := store.NewPostgresMessageStore(db, cfg.MessageEditWindow)
 	userStore := store.NewUserStore(db)
+	syncStore := store.NewPostgresSyncStore(db)
+	uploadStore := store.NewPostgresUploadStore(db)
+	inviteStore := store.NewPostgresInviteStore(db)
+	blockStore := store.NewPostgresBlockStore(db)
+	pushStore := store.NewPostgresPushStore(db)
+	presenceStore := store.NewPostgresPresenceStore(db)
 	otpStore := store.NewOTPStore(db, emailSender)
 	tokenStore := store.NewPostgresTokenStore(db)
 	userHandler := api.NewUserHandler(userStore, logger, otpStore, tokenStore)
 	authHandler := api.NewAuthHandler(logger, userStore, tokenStore, otpStore)
 	tokenHander := api.NewTokenHandler(tokenStore, userStore, logger)
-	conversationHandler := api.NewConversationHandler(messageStore, conversationStore, logger)
-	messageHandler := api.NewMessageHandler(messageStore, conversationStore, logger)
 	userMiddlewareHandler := middleware.UserMiddleware{UserStore: userStore}
 	websocketMiddlewareHandler := middleware.WebsocketMiddleware{UserStore: userStore}
-	websocketManger := websockets.NewManager(logger)
+	broker, err := newBroker(cfg, db, logger)
+	if err != nil {
+		return nil, err
+	}
+	pushEndpoints := push.EndpointPolicy{AllowPrivate: cfg.PushAllowHTTP}
+	notifier, vapidPublicKey, err := newNotifier(cfg, pushStore, pushEndpoints, logger)
+	if err != nil {
+		return nil, err
+	}
+	websocketManger, err := websockets.NewManager(logger, messageStore, conversationStore, userStore, syncStore, blockStore, presenceStore, notifier, broker)
+	if err != nil {
+		return nil, err
+	}
+	go websocketManger.RunPresenceHeartbeat(context.Background())
+	conversationHandler := api.NewConversationHandler(messageStore, conversationStore, userStore, websocketManger, logger)
+	messageHandler := api.NewMessageHandler(messageStore, conversationStore, websocketManger, logger)
+	inviteHandler := api.NewInviteHandler(inviteStore, websocketManger, logger)
+	blockHandler := api.NewBlockHandler(blockStore, userStore, logger)
+	pushHandler := api.NewPushHandler(pushStore, vapidPublicKey, pushEndpoints, logger)
+	presenceHandler := api.NewPresenceHandler(websocketManger, conversationStore, userStore, blockStore, logger)
+	syncHandler := api.NewSyncHandler(syncStore, logger)
+	blobStore, err := newBlobStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	uploadHandler := api.NewUploadHandler(uploadStore, blobStore, cfg.UploadMaxBytes, logger)
+	resumableUploadHandler, err := api.NewResumableUploadHandler(uploadHandler, cfg.UploadStagingDir, cfg.ResumableUploadMaxBytes, cfg.ResumableUploadMaxSessions, cfg.ResumableUploadUserQuota, logger)
+	if err != nil {
+		return nil, err
+	}
+	go resumableUploadHandler.RunJanitor(context.Background(), uploadJanitorInterval)
 	return &Application{
 		Logger:                     logger,
 		DB:                         db,
+		Broker:                     broker,
 		UserHandler:                userHandler,
 		EmailSender:                emailSender,
 		TokenHandler:               tokenHander,
@@ -65,9 +119,53 @@ func NewApplication() (*Application, error) {
 		WebSocketMiddlewareHandler: websocketMiddlewareHandler,
 		ConversationHandler:        conversationHandler,
 		MessageHandler:             messageHandler,
+		PresenceHandler:            presenceHandler,
+		SyncHandler:                syncHandler,
+		UploadHandler:              uploadHandler,
+		ResumableUploadHandler:     resumableUploadHandler,
+		InviteHandler:              inviteHandler,
+		BlockHandler:               blockHandler,
+		PushHandler:                pushHandler,
 	}, nil
 }
 
+func newBroker(cfg *config.Config, db *sql.DB, logger *log.Logger) (pubsub.Broker, error) {
+	switch cfg.PubSubBackend {
+	case "", "memory":
+		return pubsub.NewMemoryBroker(), nil
+	case "postgres":
+		return pubsub.NewPostgresBroker(db, "go_chat_events", logger), nil
+	default:
+		return nil, fmt.Errorf("unknown PUBSUB_BACKEND %q", cfg.PubSubBackend)
+	}
+}
+
+func newBlobStore(cfg *config.Config) (blob.BlobStore, error) {
+	switch cfg.UploadBackend {
+	case "", "local":
+		return blob.NewLocalStore(cfg.UploadDir)
+	case "s3":
+		return blob.NewS3Store(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3PathStyle)
+	default:
+		return nil, fmt.Errorf("unknown UPLOAD_BACKEND %q", cfg.UploadBackend)
+	}
+}
+
+// newNotifier sets up Web Push when a VAPID key is configured and returns
+// the public key clients subscribe with. Without one, notifications are
+// dropped.
+func newNotifier(cfg *config.Config, pushStore store.PushStore, endpoints push.EndpointPolicy, logger *log.Logger) (push.Notifier, string, error) {
+	if cfg.VAPIDPrivateKey == "" {
+		return push.NopNotifier{}, "", nil
+	}
+	vapid, err := push.ParseVAPID(cfg.VAPIDPrivateKey, cfg.VAPIDSubject)
+	if err != nil {
+		return nil, "", fmt.Errorf("VAPID_PRIVATE_KEY: %w", err)
+	}
+	client := push.NewWebPushClient(vapid, endpoints.HTTPClient(10*time.Second))
+	return push.NewDispatcher(pushStore, client, cfg.PushBatchWindow, logger), vapid.PublicKey(), nil
+}
+
 func (a *Application) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "server is running successfully")
 }
@@ -0,0 +1,194 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+func TestS3SignKnownRequest(t *testing.T) {
+	s, err := NewS3Store("http://127.0.0.1:9000", "us-east-1", "chat", testAccessKey, testSecretKey, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := s.newRequest(context.Background(), http.MethodGet, "photos/a b+c.jpg", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := req.URL.EscapedPath(), "/chat/photos/a%20b%2Bc.jpg"; got != want {
+		t.Fatalf("path = %q, want %q", got, want)
+	}
+
+	s.sign(req, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	// Computed independently of this package.
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20240102/us-east-1/s3/aws4_request, " +
+		"SignedHeaders=host;x-amz-content-sha256;x-amz-date, " +
+		"Signature=921743693a8a0ee4ad4daf7c5c936f5d835e7997884682b5fa9b026c57c54f43"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Fatalf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+	if got := req.Header.Get("X-Amz-Date"); got != "20240102T030405Z" {
+		t.Fatalf("X-Amz-Date = %q", got)
+	}
+}
+
+func TestS3StoreAgainstStandIn(t *testing.T) {
+	server := newFakeS3(t, "chat")
+	defer server.Close()
+
+	s, err := NewS3Store(server.URL, "eu-west-1", "chat", testAccessKey, testSecretKey, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	key := "uploads/some file+1"
+	data := []byte("hello, bucket")
+
+	if err := s.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "text/plain"); err != nil {
+		t.Fatal("put:", err)
+	}
+	body, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatal("get:", err)
+	}
+	got, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("get returned %q, want %q", got, data)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatal("delete:", err)
+	}
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get after delete: err = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatal("deleting a missing key should succeed:", err)
+	}
+
+	s.SecretKey = "wrong"
+	if err := s.Put(ctx, key, bytes.NewReader(data), int64(len(data)), ""); err == nil {
+		t.Fatal("put with a wrong secret succeeded")
+	}
+}
+
+// fakeS3 is a path-style S3 stand-in keeping objects in memory. It checks
+// every request's SigV4 signature the way S3 does, from what arrived on the
+// wire.
+type fakeS3 struct {
+	*httptest.Server
+	bucket  string
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(t *testing.T, bucket string) *fakeS3 {
+	f := &fakeS3{bucket: bucket, objects: make(map[string][]byte)}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := checkSignature(r, testSecretKey); err != nil {
+			t.Log("rejected request:", err)
+			http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+			return
+		}
+		key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+		if !ok {
+			http.Error(w, "NoSuchBucket", http.StatusNotFound)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			f.objects[key] = data
+		case http.MethodGet:
+			data, ok := f.objects[key]
+			if !ok {
+				http.Error(w, "NoSuchKey", http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		case http.MethodDelete:
+			if _, ok := f.objects[key]; !ok {
+				http.Error(w, "NoSuchKey", http.StatusNotFound)
+				return
+			}
+			delete(f.objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	return f
+}
+
+// checkSignature verifies the Authorization header of a request signed
+// with host, x-amz-content-sha256 and x-amz-date.
+func checkSignature(r *http.Request, secretKey string) error {
+	auth := r.Header.Get("Authorization")
+	credential, rest, ok := strings.Cut(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 Credential="), ", SignedHeaders=")
+	if !ok {
+		return errors.New("malformed Authorization header")
+	}
+	signedHeaders, signature, ok := strings.Cut(rest, ", Signature=")
+	if !ok || signedHeaders != "host;x-amz-content-sha256;x-amz-date" {
+		return errors.New("unexpected signed headers")
+	}
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 {
+		return errors.New("malformed credential")
+	}
+	date, region := parts[1], parts[2]
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	canonicalRequest := r.Method + "\n" +
+		r.URL.EscapedPath() + "\n" +
+		r.URL.RawQuery + "\n" +
+		"host:" + r.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n\n" +
+		signedHeaders + "\n" +
+		payloadHash
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" +
+		strings.Join(parts[1:], "/") + "\n" + hex.EncodeToString(hash[:])
+
+	mac := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	key := mac([]byte("AWS4"+secretKey), date)
+	key = mac(key, region)
+	key = mac(key, "s3")
+	key = mac(key, "aws4_request")
+	if want := hex.EncodeToString(mac(key, stringToSign)); signature != want {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
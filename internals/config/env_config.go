@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"time"
 )
 
 type Config struct {
@@ -20,6 +21,51 @@ type Config struct {
 	SMTPPort int
 	SMTPUser string
 	SMTPPass string
+
+	// PubSubBackend selects how WebSocket events reach other instances:
+	// "memory" (single instance, the default) or "postgres".
+	PubSubBackend string
+
+	// MessageEditWindow is how long after sending a message its sender
+	// may still edit it.
+	MessageEditWindow time.Duration
+
+	// UploadBackend selects where uploaded files are kept: "local" (the
+	// default, under UploadDir) or "s3".
+	UploadBackend  string
+	UploadDir      string
+	UploadMaxBytes int64
+
+	// Resumable uploads are assembled in UploadStagingDir, which every
+	// instance receiving chunks must share, and may be up to
+	// ResumableUploadMaxBytes. Each user may have at most
+	// ResumableUploadMaxSessions unfinished uploads, together announcing
+	// no more than ResumableUploadUserQuota bytes.
+	UploadStagingDir           string
+	ResumableUploadMaxBytes    int64
+	ResumableUploadMaxSessions int
+	ResumableUploadUserQuota   int64
+
+	// S3 settings for the "s3" upload backend. S3Endpoint may point at any
+	// S3-compatible service; local stand-ins usually need S3PathStyle.
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool
+
+	// Web Push is enabled when VAPIDPrivateKey, a base64url-encoded raw
+	// P-256 key, is set. VAPIDSubject is the mailto: or https: contact
+	// given to push services. Each user gets at most one notification per
+	// conversation every PushBatchWindow.
+	VAPIDPrivateKey string
+	VAPIDSubject    string
+	PushBatchWindow time.Duration
+	// PushAllowHTTP accepts plain http push endpoints and ones on loopback
+	// or private addresses, for testing against a local mock push service.
+	// Never set it in production.
+	PushAllowHTTP bool
 }
 
 func Load() *Config {
@@ -30,6 +76,68 @@ func Load() *Config {
 
 	jwtExp, _ := strconv.Atoi(os.Getenv("JWT_EXP_MINUTES"))
 
+	editWindow := 15 * time.Minute
+	if value := os.Getenv("MESSAGE_EDIT_WINDOW"); value != "" {
+		editWindow, err = time.ParseDuration(value)
+		if err != nil {
+			log.Fatal("Invalid MESSAGE_EDIT_WINDOW")
+		}
+	}
+
+	uploadDir := os.Getenv("UPLOAD_DIR")
+	if uploadDir == "" {
+		uploadDir = "./uploads"
+	}
+
+	var uploadMaxBytes int64 = 25 << 20
+	if value := os.Getenv("UPLOAD_MAX_BYTES"); value != "" {
+		uploadMaxBytes, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || uploadMaxBytes < 1 {
+			log.Fatal("Invalid UPLOAD_MAX_BYTES")
+		}
+	}
+
+	uploadStagingDir := os.Getenv("UPLOAD_STAGING_DIR")
+	if uploadStagingDir == "" {
+		uploadStagingDir = "./uploads-staging"
+	}
+
+	var resumableMaxBytes int64 = 2 << 30
+	if value := os.Getenv("RESUMABLE_UPLOAD_MAX_BYTES"); value != "" {
+		resumableMaxBytes, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || resumableMaxBytes < 1 {
+			log.Fatal("Invalid RESUMABLE_UPLOAD_MAX_BYTES")
+		}
+	}
+
+	resumableMaxSessions := 5
+	if value := os.Getenv("RESUMABLE_UPLOAD_MAX_SESSIONS"); value != "" {
+		resumableMaxSessions, err = strconv.Atoi(value)
+		if err != nil || resumableMaxSessions < 1 {
+			log.Fatal("Invalid RESUMABLE_UPLOAD_MAX_SESSIONS")
+		}
+	}
+
+	resumableUserQuota := 2 * resumableMaxBytes
+	if value := os.Getenv("RESUMABLE_UPLOAD_USER_QUOTA"); value != "" {
+		resumableUserQuota, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || resumableUserQuota < 1 {
+			log.Fatal("Invalid RESUMABLE_UPLOAD_USER_QUOTA")
+		}
+	}
+
+	s3PathStyle, _ := strconv.ParseBool(os.Getenv("S3_PATH_STYLE"))
+
+	pushBatchWindow := 30 * time.Second
+	if value := os.Getenv("PUSH_BATCH_WINDOW"); value != "" {
+		pushBatchWindow, err = time.ParseDuration(value)
+		if err != nil || pushBatchWindow <= 0 {
+			log.Fatal("Invalid PUSH_BATCH_WINDOW")
+		}
+	}
+
+	pushAllowHTTP, _ := strconv.ParseBool(os.Getenv("PUSH_ALLOW_HTTP"))
+
 	return &Config{
 		DB_HOST: os.Getenv("DB_HOST"),
 		DB_PORT: os.Getenv("DB_PORT"),
@@ -44,5 +152,30 @@ func Load() *Config {
 		SMTPPort: smtpPort,
 		SMTPUser: os.Getenv("SMTP_USERNAME"),
 		SMTPPass: os.Getenv("SMTP_PASSWORD"),
+
+		PubSubBackend: os.Getenv("PUBSUB_BACKEND"),
+
+		MessageEditWindow: editWindow,
+
+		UploadBackend:  os.Getenv("UPLOAD_BACKEND"),
+		UploadDir:      uploadDir,
+		UploadMaxBytes: uploadMaxBytes,
+
+		UploadStagingDir:           uploadStagingDir,
+		ResumableUploadMaxBytes:    resumableMaxBytes,
+		ResumableUploadMaxSessions: resumableMaxSessions,
+		ResumableUploadUserQuota:   resumableUserQuota,
+
+		S3Endpoint:  os.Getenv("S3_ENDPOINT"),
+		S3Region:    os.Getenv("S3_REGION"),
+		S3Bucket:    os.Getenv("S3_BUCKET"),
+		S3AccessKey: os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey: os.Getenv("S3_SECRET_KEY"),
+		S3PathStyle: s3PathStyle,
+
+		VAPIDPrivateKey: os.Getenv("VAPID_PRIVATE_KEY"),
+		VAPIDSubject:    os.Getenv("VAPID_SUBJECT"),
+		PushBatchWindow: pushBatchWindow,
+		PushAllowHTTP:   pushAllowHTTP,
 	}
 }
\ No newline at end of file
@@ -0,0 +1,85 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// MaxGIFFrames bounds the frames of an animated GIF.
+	MaxGIFFrames = 500
+	// MaxGIFPixels bounds the pixels of all frames of a GIF together. Each
+	// decoded frame takes a byte per pixel, and frames may be smaller than
+	// the logical screen that MaxPixels is checked against.
+	MaxGIFPixels = 100_000_000
+)
+
+var errBadGIF = errors.New("gif: malformed block structure")
+
+// checkGIF walks the block structure of a GIF without decoding any pixels
+// and fails with ErrTooLarge when decoding it would exceed MaxGIFFrames or
+// MaxGIFPixels.
+func checkGIF(data []byte) error {
+	// Header and logical screen descriptor.
+	if len(data) < 13 {
+		return errBadGIF
+	}
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1)
+	}
+
+	frames := 0
+	var pixels int64
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // extension: label, then data sub-blocks
+			var err error
+			if pos, err = skipSubBlocks(data, pos+2); err != nil {
+				return err
+			}
+		case 0x2C: // image descriptor
+			if pos+10 > len(data) {
+				return errBadGIF
+			}
+			width := int64(binary.LittleEndian.Uint16(data[pos+5:]))
+			height := int64(binary.LittleEndian.Uint16(data[pos+7:]))
+			flags := data[pos+9]
+			frames++
+			pixels += width * height
+			if frames > MaxGIFFrames || pixels > MaxGIFPixels {
+				return ErrTooLarge
+			}
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			// LZW minimum code size, then the image data sub-blocks.
+			var err error
+			if pos, err = skipSubBlocks(data, pos+1); err != nil {
+				return err
+			}
+		case 0x3B: // trailer
+			return nil
+		default:
+			return errBadGIF
+		}
+	}
+	return nil
+}
+
+// skipSubBlocks returns the position after the run of data sub-blocks that
+// starts at pos.
+func skipSubBlocks(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, errBadGIF
+		}
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos, nil
+		}
+		pos += size
+	}
+}
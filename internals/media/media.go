@@ -0,0 +1,172 @@
+// Package media prepares uploaded images for sharing: it re-encodes them
+// without metadata such as EXIF location data and renders thumbnails.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// MaxPixels bounds the size of images that are decoded, so a small file
+// declaring huge dimensions can't exhaust memory. Animated GIFs are further
+// bounded by MaxGIFFrames and MaxGIFPixels.
+const MaxPixels = 40_000_000
+
+const jpegQuality = 85
+
+var (
+	ErrUnsupported = errors.New("unsupported image type")
+	ErrTooLarge    = errors.New("image dimensions are too large")
+)
+
+// ThumbnailSizes are the thumbnails rendered for each image, by name, as the
+// longest side in pixels. Images already smaller get none of that size.
+var ThumbnailSizes = []struct {
+	Name string
+	Max  int
+}{
+	{"small", 320},
+	{"medium", 1024},
+}
+
+type Image struct {
+	Data     []byte
+	MimeType string
+	Width    int
+	Height   int
+}
+
+type Thumbnail struct {
+	Name string
+	Image
+}
+
+type Processed struct {
+	// Original is the uploaded image, upright and with its metadata
+	// removed.
+	Original   Image
+	Thumbnails []Thumbnail
+}
+
+// Supported reports whether Process handles images of mimeType.
+func Supported(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// Process decodes an image and re-encodes it and its thumbnails. Decoding
+// and encoding again drops every metadata block (EXIF, XMP, text chunks);
+// a JPEG's EXIF orientation is applied to the pixels first so the image
+// still displays the right way up.
+func Process(data []byte, mimeType string) (*Processed, error) {
+	if !Supported(mimeType) {
+		return nil, ErrUnsupported
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	var (
+		original *Image
+		pixels   *image.RGBA
+	)
+	switch mimeType {
+	case "image/jpeg":
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		pixels = orientedRGBA(img, jpegOrientation(data))
+		original, err = encode(pixels, "image/jpeg")
+		if err != nil {
+			return nil, err
+		}
+	case "image/png":
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		pixels = toRGBA(img)
+		original, err = encode(pixels, "image/png")
+		if err != nil {
+			return nil, err
+		}
+	case "image/gif":
+		// Animations are kept: every frame is re-encoded, which drops
+		// comment and application extensions. Thumbnails show the
+		// first frame.
+		if err := checkGIF(data); err != nil {
+			return nil, err
+		}
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if len(anim.Image) == 0 {
+			return nil, ErrUnsupported
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, &gif.GIF{
+			Image:     anim.Image,
+			Delay:     anim.Delay,
+			LoopCount: anim.LoopCount,
+			Disposal:  anim.Disposal,
+			Config:    anim.Config,
+		}); err != nil {
+			return nil, err
+		}
+		original = &Image{Data: buf.Bytes(), MimeType: "image/gif", Width: config.Width, Height: config.Height}
+		pixels = toRGBA(anim.Image[0])
+	}
+
+	processed := &Processed{Original: *original}
+	width, height := original.Width, original.Height
+	for _, size := range ThumbnailSizes {
+		if width <= size.Max && height <= size.Max {
+			continue
+		}
+		tw, th := fit(width, height, size.Max)
+		thumbnailMime := "image/jpeg"
+		if mimeType != "image/jpeg" {
+			thumbnailMime = "image/png"
+		}
+		thumbnail, err := encode(resize(pixels, tw, th), thumbnailMime)
+		if err != nil {
+			return nil, err
+		}
+		processed.Thumbnails = append(processed.Thumbnails, Thumbnail{Name: size.Name, Image: *thumbnail})
+	}
+	return processed, nil
+}
+
+func encode(img *image.RGBA, mimeType string) (*Image, error) {
+	var buf bytes.Buffer
+	var err error
+	switch mimeType {
+	case "image/jpeg":
+		if !img.Opaque() {
+			img = flatten(img)
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	case "image/png":
+		err = png.Encode(&buf, img)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	return &Image{Data: buf.Bytes(), MimeType: mimeType, Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
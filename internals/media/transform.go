@@ -0,0 +1,121 @@
+package media
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// toRGBA returns img as an RGBA image starting at the origin, copying it
+// only when it isn't one already.
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	if rgba, ok := img.(*image.RGBA); ok && bounds.Min == (image.Point{}) {
+		return rgba
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
+
+// orientedRGBA converts img to RGBA and turns it upright according to its
+// EXIF orientation in one pass. Only one row is converted at a time, so
+// apart from img itself a single full-size copy is ever allocated.
+func orientedRGBA(img image.Image, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return toRGBA(img)
+	}
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	row := image.NewRGBA(image.Rect(0, 0, w, 1))
+	for y := 0; y < h; y++ {
+		draw.Draw(row, row.Bounds(), img, image.Pt(bounds.Min.X, bounds.Min.Y+y), draw.Src)
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			di := dst.PixOffset(dx, dy)
+			copy(dst.Pix[di:di+4], row.Pix[x*4:x*4+4])
+		}
+	}
+	return dst
+}
+
+// fit scales width x height down to fit within max on both sides, keeping
+// the aspect ratio.
+func fit(width, height, max int) (int, int) {
+	if width <= max && height <= max {
+		return width, height
+	}
+	if width >= height {
+		return max, maxInt(1, height*max/width)
+	}
+	return maxInt(1, width*max/height), max
+}
+
+// resize shrinks src to width x height, averaging every source pixel that
+// falls within each destination pixel. It is only meant for downscaling.
+func resize(src *image.RGBA, width, height int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for dy := 0; dy < height; dy++ {
+		y0 := dy * sh / height
+		y1 := maxInt(y0+1, (dy+1)*sh/height)
+		for dx := 0; dx < width; dx++ {
+			x0 := dx * sw / width
+			x1 := maxInt(x0+1, (dx+1)*sw/width)
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				i := src.PixOffset(x0, y)
+				for x := x0; x < x1; x++ {
+					r += uint64(src.Pix[i])
+					g += uint64(src.Pix[i+1])
+					b += uint64(src.Pix[i+2])
+					a += uint64(src.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+			di := dst.PixOffset(dx, dy)
+			dst.Pix[di] = uint8(r / n)
+			dst.Pix[di+1] = uint8(g / n)
+			dst.Pix[di+2] = uint8(b / n)
+			dst.Pix[di+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// flatten draws img over an opaque white background, for encoding as JPEG.
+func flatten(img *image.RGBA) *image.RGBA {
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
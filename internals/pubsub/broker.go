@@ -0,0 +1,14 @@
+package pubsub
+
+import (
+	"context"
+)
+
+// Broker carries opaque payloads of any size between every server instance. Each
+// payload published by any instance is handed to every subscriber on every
+// instance, including the publisher itself.
+type Broker interface {
+	Publish(ctx context.Context, payload []byte) error
+	Subscribe(handler func(payload []byte)) error
+	Close() error
+}
@@ -0,0 +1,42 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBroker delivers payloads to subscribers in the same process. It is
+// what a single instance (and tests) run with.
+type MemoryBroker struct {
+	sync.RWMutex
+	handlers []func(payload []byte)
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, payload []byte) error {
+	b.RLock()
+	handlers := append([]func([]byte){}, b.handlers...)
+	b.RUnlock()
+
+	for _, handler := range handlers {
+		handler(payload)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(handler func(payload []byte)) error {
+	b.Lock()
+	defer b.Unlock()
+	b.handlers = append(b.handlers, handler)
+	return nil
+}
+
+func (b *MemoryBroker) Close() error {
+	b.Lock()
+	defer b.Unlock()
+	b.handlers = nil
+	return nil
+}
@@ -0,0 +1,174 @@
+package pubsub
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+// maxNotifyPayload is just under Postgres' 8000 byte NOTIFY limit.
+const maxNotifyPayload = 7999
+
+const (
+	reconnectDelay = 2 * time.Second
+	// payloadRetention is how long spilled payloads are kept for listeners
+	// to read.
+	payloadRetention = 5 * time.Minute
+	fetchTimeout     = 5 * time.Second
+)
+
+// Notifications start with a tag saying whether the payload follows inline
+// or was spilled to the pubsub_payloads table and only its id follows.
+const (
+	tagInline = 'i'
+	tagRef    = 'r'
+)
+
+// PostgresBroker fans payloads out between instances with LISTEN/NOTIFY on
+// the database they already share. Payloads that don't fit in a NOTIFY are
+// stored in pubsub_payloads and sent by reference.
+type PostgresBroker struct {
+	db      *sql.DB
+	channel string
+	logger  *log.Logger
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewPostgresBroker(db *sql.DB, channel string, logger *log.Logger) *PostgresBroker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &PostgresBroker{
+		db:      db,
+		channel: channel,
+		logger:  logger,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+func (b *PostgresBroker) Publish(ctx context.Context, payload []byte) error {
+	if len(payload)+1 <= maxNotifyPayload {
+		_, err := b.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, b.channel, string(tagInline)+string(payload))
+		return err
+	}
+	return b.publishRef(ctx, payload)
+}
+
+// publishRef stores payload and notifies its id, in one transaction so
+// listeners never see the id before the row. Old payloads are pruned on
+// the way.
+func (b *PostgresBroker) publishRef(ctx context.Context, payload []byte) error {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM pubsub_payloads
+		WHERE created_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'`,
+		payloadRetention.Seconds(),
+	); err != nil {
+		return err
+	}
+	var id int64
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO pubsub_payloads (payload) VALUES ($1) RETURNING id`,
+		payload,
+	).Scan(&id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, b.channel, string(tagRef)+strconv.FormatInt(id, 10)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// resolve turns a notification back into the payload that was published.
+func (b *PostgresBroker) resolve(notification string) ([]byte, error) {
+	if notification == "" {
+		return nil, fmt.Errorf("empty notification")
+	}
+	switch notification[0] {
+	case tagInline:
+		return []byte(notification[1:]), nil
+	case tagRef:
+		id, err := strconv.ParseInt(notification[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad payload reference %q", notification)
+		}
+		ctx, cancel := context.WithTimeout(b.ctx, fetchTimeout)
+		defer cancel()
+		var payload []byte
+		err = b.db.QueryRowContext(ctx, `SELECT payload FROM pubsub_payloads WHERE id = $1`, id).Scan(&payload)
+		if err != nil {
+			return nil, fmt.Errorf("fetching payload %d: %w", id, err)
+		}
+		return payload, nil
+	default:
+		return nil, fmt.Errorf("unknown notification tag %q", notification[0])
+	}
+}
+
+// Subscribe starts listening in the background. The listener holds one
+// connection from the pool and reconnects whenever it is lost; payloads
+// published while it is disconnected are missed.
+func (b *PostgresBroker) Subscribe(handler func(payload []byte)) error {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		for b.ctx.Err() == nil {
+			err := b.listen(handler)
+			if b.ctx.Err() != nil {
+				return
+			}
+			b.logger.Println("pubsub listener stopped, reconnecting:", err)
+			select {
+			case <-time.After(reconnectDelay):
+			case <-b.ctx.Done():
+			}
+		}
+	}()
+	return nil
+}
+
+func (b *PostgresBroker) listen(handler func(payload []byte)) error {
+	conn, err := b.db.Conn(b.ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		pgxConn := driverConn.(*stdlib.Conn).Conn()
+		if _, err := pgxConn.Exec(b.ctx, "LISTEN "+pgx.Identifier{b.channel}.Sanitize()); err != nil {
+			return err
+		}
+		for {
+			notification, err := pgxConn.WaitForNotification(b.ctx)
+			if err != nil {
+				return err
+			}
+			payload, err := b.resolve(notification.Payload)
+			if err != nil {
+				b.logger.Println("error reading pubsub notification:", err)
+				continue
+			}
+			handler(payload)
+		}
+	})
+}
+
+func (b *PostgresBroker) Close() error {
+	b.cancel()
+	b.wg.Wait()
+	return nil
+}
@@ -0,0 +1,225 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-chat/internals/store"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// messageTTL is how long push services hold a notification for a
+	// device that is off.
+	messageTTL = 24 * time.Hour
+	// storeTimeout bounds each database call, sendTimeout each request to
+	// a push service.
+	storeTimeout = 5 * time.Second
+	sendTimeout  = 10 * time.Second
+
+	// workers is how many batches are sent at once, each holding at most
+	// one database connection; queueSize is how many deliveries may wait
+	// for them; batchSize is how many deliveries share one subscription
+	// lookup.
+	workers   = 4
+	queueSize = 1024
+	batchSize = 100
+)
+
+// Payload is what a device receives, as JSON. Count is how many messages
+// the notification stands for; the rest describes the latest of them.
+type Payload struct {
+	Notification
+	Count int `json:"count"`
+}
+
+type batchKey struct {
+	userID         uuid.UUID
+	conversationID uuid.UUID
+}
+
+// delivery is one payload due to go out to every device of a user.
+type delivery struct {
+	key     batchKey
+	payload Payload
+}
+
+// batch collects the notifications for one user and conversation that came
+// in while the previous one was held back.
+type batch struct {
+	latest  Notification
+	count   int
+	mention bool
+}
+
+// Dispatcher is a Notifier sending Web Push messages. The first message of
+// a conversation goes out right away; anything more for the same user and
+// conversation within Window is folded into a single follow-up, so a busy
+// group pushes at most once per Window. Sending is done by a fixed pool of
+// workers. Notifications still waiting when the process stops are lost.
+type Dispatcher struct {
+	PushStore store.PushStore
+	Client    *WebPushClient
+	Window    time.Duration
+	Logger    *log.Logger
+
+	mu      sync.Mutex
+	pending map[batchKey]*batch
+	queue   chan delivery
+}
+
+func NewDispatcher(pushStore store.PushStore, client *WebPushClient, window time.Duration, logger *log.Logger) *Dispatcher {
+	d := &Dispatcher{
+		PushStore: pushStore,
+		Client:    client,
+		Window:    window,
+		Logger:    logger,
+		pending:   make(map[batchKey]*batch),
+		queue:     make(chan delivery, queueSize),
+	}
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+	return d
+}
+
+// Notify queues notifications for sending. It waits for room in the queue
+// until ctx is done, then gives up on the rest.
+func (d *Dispatcher) Notify(ctx context.Context, notifications []Notification) error {
+	var due []delivery
+	d.mu.Lock()
+	for _, n := range notifications {
+		key := batchKey{userID: n.UserID, conversationID: n.ConversationID}
+		if b, ok := d.pending[key]; ok {
+			b.latest = n
+			b.count++
+			b.mention = b.mention || n.Mention
+			continue
+		}
+		d.pending[key] = &batch{}
+		time.AfterFunc(d.Window, func() { d.flush(key) })
+		due = append(due, delivery{key: key, payload: Payload{Notification: n, Count: 1}})
+	}
+	d.mu.Unlock()
+
+	for _, dl := range due {
+		select {
+		case d.queue <- dl:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// flush sends what piled up for key during the last window, and keeps
+// holding back for another window if anything did.
+func (d *Dispatcher) flush(key batchKey) {
+	d.mu.Lock()
+	b := d.pending[key]
+	if b == nil || b.count == 0 {
+		delete(d.pending, key)
+		d.mu.Unlock()
+		return
+	}
+	payload := Payload{Notification: b.latest, Count: b.count}
+	payload.Mention = b.mention
+	d.pending[key] = &batch{}
+	time.AfterFunc(d.Window, func() { d.flush(key) })
+	d.mu.Unlock()
+
+	d.queue <- delivery{key: key, payload: payload}
+}
+
+// work sends queued deliveries, taking whatever else is already waiting
+// along so they share one subscription lookup.
+func (d *Dispatcher) work() {
+	for first := range d.queue {
+		deliveries := []delivery{first}
+	collect:
+		for len(deliveries) < batchSize {
+			select {
+			case dl := <-d.queue:
+				deliveries = append(deliveries, dl)
+			default:
+				break collect
+			}
+		}
+		d.send(deliveries)
+	}
+}
+
+func (d *Dispatcher) send(deliveries []delivery) {
+	userIDs := make([]uuid.UUID, 0, len(deliveries))
+	seen := make(map[uuid.UUID]bool, len(deliveries))
+	for _, dl := range deliveries {
+		if !seen[dl.key.userID] {
+			seen[dl.key.userID] = true
+			userIDs = append(userIDs, dl.key.userID)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	subs, err := d.PushStore.GetPushSubscriptions(ctx, userIDs)
+	cancel()
+	if err != nil {
+		d.Logger.Println("error fetching push subscriptions:", err)
+		return
+	}
+	byUser := make(map[uuid.UUID][]store.PushSubscription, len(userIDs))
+	for _, sub := range subs {
+		byUser[sub.UserID] = append(byUser[sub.UserID], sub)
+	}
+
+	gone := make(map[string]bool)
+	for _, dl := range deliveries {
+		if len(byUser[dl.key.userID]) == 0 {
+			continue
+		}
+		data, err := json.Marshal(dl.payload)
+		if err != nil {
+			d.Logger.Println("error marshalling push payload:", err)
+			continue
+		}
+		msg := Message{
+			Payload: data,
+			TTL:     messageTTL,
+			// Devices that were off only get the newest notification of
+			// each conversation.
+			Topic:   strings.ReplaceAll(dl.key.conversationID.String(), "-", ""),
+			Urgency: "normal",
+		}
+		if dl.payload.Mention {
+			msg.Urgency = "high"
+		}
+		for _, sub := range byUser[dl.key.userID] {
+			if gone[sub.Endpoint] {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			err := d.Client.Send(ctx, Subscription{Endpoint: sub.Endpoint, P256dh: sub.P256dh, Auth: sub.Auth}, msg)
+			cancel()
+			if errors.Is(err, ErrSubscriptionGone) {
+				gone[sub.Endpoint] = true
+				d.forget(sub.Endpoint)
+				continue
+			}
+			if err != nil {
+				d.Logger.Println("error sending push notification:", err)
+			}
+		}
+	}
+}
+
+// forget deletes a subscription the push service no longer knows.
+func (d *Dispatcher) forget(endpoint string) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := d.PushStore.DeletePushSubscriptionByEndpoint(ctx, endpoint); err != nil {
+		d.Logger.Println("error deleting push subscription:", err)
+	}
+}
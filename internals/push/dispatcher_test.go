@@ -0,0 +1,145 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"go-chat/internals/store"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memoryPushStore is a PushStore keeping subscriptions in memory.
+type memoryPushStore struct {
+	mu      sync.Mutex
+	subs    []store.PushSubscription
+	lookups int
+}
+
+func (s *memoryPushStore) SavePushSubscription(ctx context.Context, sub *store.PushSubscription) (*store.PushSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs = append(s.subs, *sub)
+	return sub, nil
+}
+
+func (s *memoryPushStore) GetPushSubscriptions(ctx context.Context, userIDs []uuid.UUID) ([]store.PushSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lookups++
+	var subs []store.PushSubscription
+	for _, sub := range s.subs {
+		for _, userID := range userIDs {
+			if sub.UserID == userID {
+				subs = append(subs, sub)
+			}
+		}
+	}
+	return subs, nil
+}
+
+func (s *memoryPushStore) DeletePushSubscription(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	return nil
+}
+
+func (s *memoryPushStore) DeletePushSubscriptionByEndpoint(ctx context.Context, endpoint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.subs[:0]
+	for _, sub := range s.subs {
+		if sub.Endpoint != endpoint {
+			kept = append(kept, sub)
+		}
+	}
+	s.subs = kept
+	return nil
+}
+
+func (s *memoryPushStore) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subs)
+}
+
+func TestDispatcherBatchesAndForgetsGoneSubscriptions(t *testing.T) {
+	received := make(chan Payload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		plaintext, err := decryptForTest(body, rfcUAPrivate, rfcAuthSecret)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var payload Payload
+		if err := json.Unmarshal(plaintext, &payload); err != nil {
+			t.Error(err)
+			return
+		}
+		received <- payload
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	alice, bob := uuid.New(), uuid.New()
+	pushStore := &memoryPushStore{}
+	for _, sub := range []store.PushSubscription{
+		{UserID: alice, Endpoint: server.URL + "/alice", P256dh: rfcUAPublic, Auth: rfcAuthSecret},
+		{UserID: bob, Endpoint: server.URL + "/gone", P256dh: rfcUAPublic, Auth: rfcAuthSecret},
+	} {
+		pushStore.SavePushSubscription(context.Background(), &sub)
+	}
+	client := NewWebPushClient(newTestVAPID(t), EndpointPolicy{AllowPrivate: true}.HTTPClient(time.Second))
+	d := NewDispatcher(pushStore, client, 100*time.Millisecond, log.New(io.Discard, "", 0))
+
+	conversationID := uuid.New()
+	notify := func(userID uuid.UUID, body string, mention bool) {
+		err := d.Notify(context.Background(), []Notification{{
+			UserID: userID, ConversationID: conversationID, MessageID: uuid.New(), Body: body, Mention: mention,
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	notify(alice, "first", false)
+	notify(bob, "first", false)
+	notify(alice, "second", true)
+	notify(alice, "third", false)
+
+	first := waitPayload(t, received)
+	if first.Body != "first" || first.Count != 1 {
+		t.Fatalf("first push = %+v, want the first message alone", first)
+	}
+	batched := waitPayload(t, received)
+	if batched.Body != "third" || batched.Count != 2 || !batched.Mention {
+		t.Fatalf("batched push = %+v, want the latest message, a count of 2 and the mention", batched)
+	}
+	select {
+	case extra := <-received:
+		t.Fatalf("unexpected push %+v", extra)
+	case <-time.After(300 * time.Millisecond):
+	}
+	if n := pushStore.count(); n != 1 {
+		t.Fatalf("%d subscriptions left, want the gone one removed", n)
+	}
+}
+
+func waitPayload(t *testing.T, received <-chan Payload) Payload {
+	t.Helper()
+	select {
+	case payload := <-received:
+		return payload
+	case <-time.After(2 * time.Second):
+		t.Fatal("no push arrived")
+		return Payload{}
+	}
+}
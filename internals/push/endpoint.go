@@ -0,0 +1,149 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdh"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrInvalidEndpoint   = errors.New("push endpoint must be an https URL")
+	ErrForbiddenEndpoint = errors.New("push endpoint resolves to a non-public address")
+)
+
+// EndpointPolicy decides which push endpoints the server may talk to.
+// Endpoints come from users, so by default only https URLs on public
+// addresses are allowed; anything else would let a user point the server
+// at internal hosts.
+type EndpointPolicy struct {
+	// AllowPrivate also accepts plain http and loopback, private and
+	// link-local addresses, for testing against a local mock push
+	// service.
+	AllowPrivate bool
+	Resolver     *net.Resolver
+}
+
+// Check validates a subscription endpoint before it is stored: the scheme,
+// and every address its host resolves to right now. The dialer of
+// HTTPClient checks again at connect time, since DNS may change in between.
+func (p EndpointPolicy) Check(ctx context.Context, endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Hostname() == "" || u.User != nil {
+		return ErrInvalidEndpoint
+	}
+	if u.Scheme != "https" && !(p.AllowPrivate && u.Scheme == "http") {
+		return ErrInvalidEndpoint
+	}
+	if p.AllowPrivate {
+		return nil
+	}
+
+	resolver := p.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("%w: cannot resolve %s", ErrInvalidEndpoint, u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !isPublic(addr) {
+			return ErrForbiddenEndpoint
+		}
+	}
+	return nil
+}
+
+// HTTPClient returns a client for talking to push services. It refuses to
+// connect to non-public addresses unless AllowPrivate is set, and never
+// follows redirects: a push service answers directly, and a redirect is
+// only a way around the address check.
+func (p EndpointPolicy) HTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !p.AllowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublic(addrPort.Addr()) {
+				return ErrForbiddenEndpoint
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// isPublic reports whether addr is a globally routable unicast address.
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	switch {
+	case !addr.IsValid(),
+		addr.IsUnspecified(),
+		addr.IsLoopback(),
+		addr.IsPrivate(),
+		addr.IsLinkLocalUnicast(),
+		addr.IsLinkLocalMulticast(),
+		addr.IsInterfaceLocalMulticast(),
+		addr.IsMulticast():
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// nonPublicPrefixes are special-purpose ranges netip has no predicate for.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64 can reach IPv4 private space
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// ValidateKeys checks that p256dh is a P-256 public key and auth a 16-byte
+// secret, both base64url-encoded, so bad subscriptions are refused up front
+// rather than failing on every send.
+func ValidateKeys(p256dh, auth string) error {
+	_, _, err := parseKeys(Subscription{P256dh: p256dh, Auth: auth})
+	return err
+}
+
+func parseKeys(sub Subscription) (*ecdh.PublicKey, []byte, error) {
+	rawUAKey, err := b64.DecodeString(sub.P256dh)
+	if err != nil {
+		return nil, nil, ErrInvalidKey
+	}
+	uaKey, err := ecdh.P256().NewPublicKey(rawUAKey)
+	if err != nil {
+		return nil, nil, ErrInvalidKey
+	}
+	authSecret, err := b64.DecodeString(sub.Auth)
+	if err != nil || len(authSecret) != 16 {
+		return nil, nil, ErrInvalidKey
+	}
+	return uaKey, authSecret, nil
+}
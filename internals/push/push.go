@@ -0,0 +1,35 @@
+// Package push tells users about messages while they have no WebSocket
+// connection open.
+package push
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Notification is one message worth telling an offline user about.
+type Notification struct {
+	UserID         uuid.UUID `json:"-"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	MessageID      uuid.UUID `json:"message_id"`
+	Title          string    `json:"title"`
+	Body           string    `json:"body"`
+	// Mention is set when the message mentions the user.
+	Mention bool `json:"mention"`
+}
+
+// Notifier delivers notifications to users' devices. Implementations may
+// deliver later than Notify returns, and may fold several notifications
+// into one.
+type Notifier interface {
+	Notify(ctx context.Context, notifications []Notification) error
+}
+
+// NopNotifier drops every notification. It is used when push is not
+// configured.
+type NopNotifier struct{}
+
+func (NopNotifier) Notify(ctx context.Context, notifications []Notification) error {
+	return nil
+}
@@ -0,0 +1,277 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// MaxPayload is the most plaintext that fits in the single 4096-byte
+// record push services are required to accept.
+const MaxPayload = recordSize - headerSize - 16 - 1
+
+const (
+	recordSize = 4096
+	// headerSize is salt, record size, key id length and the 65-byte key.
+	headerSize = 16 + 4 + 1 + 65
+
+	// vapidTokenTTL is how long a VAPID token is valid; RFC 8292 allows
+	// at most 24 hours.
+	vapidTokenTTL = 12 * time.Hour
+)
+
+var (
+	// ErrSubscriptionGone is returned when the push service no longer
+	// knows the subscription, which should then be forgotten.
+	ErrSubscriptionGone = errors.New("push subscription is no longer valid")
+	ErrPayloadTooLarge  = errors.New("push payload is too large")
+	ErrInvalidKey       = errors.New("invalid push key")
+)
+
+var b64 = base64.RawURLEncoding
+
+// Subscription is where and how to reach one browser or device, as handed
+// out by the Push API.
+type Subscription struct {
+	Endpoint string
+	// P256dh and Auth are the base64url-encoded keys of the subscription.
+	P256dh string
+	Auth   string
+}
+
+// Message is a payload and the delivery options it is sent with.
+type Message struct {
+	Payload []byte
+	// TTL is how long the push service keeps the message for an
+	// unreachable device.
+	TTL time.Duration
+	// Topic makes the push service replace an undelivered message with the
+	// same topic instead of queuing both. At most 32 base64url characters.
+	Topic string
+	// Urgency is "very-low", "low", "normal" or "high".
+	Urgency string
+}
+
+// VAPID identifies this server to push services (RFC 8292).
+type VAPID struct {
+	key       *ecdsa.PrivateKey
+	publicKey []byte
+	// Subject is a mailto: or https: URL push services can use to reach
+	// the operator.
+	Subject string
+}
+
+// ParseVAPID reads a base64url-encoded raw P-256 private key, the format
+// common web push tooling generates.
+func ParseVAPID(privateKey, subject string) (*VAPID, error) {
+	raw, err := b64.DecodeString(privateKey)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	public := key.PublicKey().Bytes()
+	return &VAPID{
+		key: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(public[1:33]),
+				Y:     new(big.Int).SetBytes(public[33:]),
+			},
+			D: new(big.Int).SetBytes(raw),
+		},
+		publicKey: public,
+		Subject:   subject,
+	}, nil
+}
+
+// PublicKey is the base64url-encoded key browsers subscribe with
+// (applicationServerKey).
+func (v *VAPID) PublicKey() string {
+	return b64.EncodeToString(v.publicKey)
+}
+
+// authorization builds the Authorization header for a request to endpoint.
+func (v *VAPID) authorization(endpoint string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	header, err := json.Marshal(map[string]string{"typ": "JWT", "alg": "ES256"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(vapidTokenTTL).Unix(),
+		"sub": v.Subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := b64.EncodeToString(header) + "." + b64.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, v.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	// JWS wants the bare 32-byte r and s, not ASN.1.
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	token := signingInput + "." + b64.EncodeToString(signature)
+	return "vapid t=" + token + ", k=" + v.PublicKey(), nil
+}
+
+// WebPushClient sends messages to Web Push services (RFC 8030). Any
+// endpoint speaking the protocol works, including a local mock.
+type WebPushClient struct {
+	VAPID      *VAPID
+	HTTPClient *http.Client
+}
+
+func NewWebPushClient(vapid *VAPID, httpClient *http.Client) *WebPushClient {
+	return &WebPushClient{
+		VAPID:      vapid,
+		HTTPClient: httpClient,
+	}
+}
+
+// Send encrypts msg for sub and hands it to sub's push service.
+func (c *WebPushClient) Send(ctx context.Context, sub Subscription, msg Message) error {
+	if len(msg.Payload) > MaxPayload {
+		return ErrPayloadTooLarge
+	}
+	body, err := Encrypt(sub, msg.Payload)
+	if err != nil {
+		return err
+	}
+	authorization, err := c.VAPID.authorization(sub.Endpoint, time.Now())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(msg.TTL/time.Second)))
+	if msg.Topic != "" {
+		req.Header.Set("Topic", msg.Topic)
+	}
+	if msg.Urgency != "" {
+		req.Header.Set("Urgency", msg.Urgency)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrSubscriptionGone
+	case resp.StatusCode == http.StatusRequestEntityTooLarge:
+		return ErrPayloadTooLarge
+	default:
+		return fmt.Errorf("push service answered %s", resp.Status)
+	}
+}
+
+// Encrypt encrypts plaintext for sub as a single aes128gcm record
+// (RFC 8291), with a fresh key pair and salt.
+func Encrypt(sub Subscription, plaintext []byte) ([]byte, error) {
+	serverKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return encrypt(sub, plaintext, serverKey, salt)
+}
+
+func encrypt(sub Subscription, plaintext []byte, serverKey *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	if len(plaintext) > MaxPayload {
+		return nil, ErrPayloadTooLarge
+	}
+	uaKey, authSecret, err := parseKeys(sub)
+	if err != nil {
+		return nil, err
+	}
+	rawUAKey := uaKey.Bytes()
+
+	sharedSecret, err := serverKey.ECDH(uaKey)
+	if err != nil {
+		return nil, err
+	}
+	serverPublic := serverKey.PublicKey().Bytes()
+
+	keyInfo := append([]byte("WebPush: info\x00"), rawUAKey...)
+	keyInfo = append(keyInfo, serverPublic...)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, authSecret, string(keyInfo), 32)
+	if err != nil {
+		return nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(serverPublic)))
+	header = append(header, serverPublic...)
+
+	// 0x02 marks the last (and only) record; no padding follows.
+	record := append(append([]byte{}, plaintext...), 0x02)
+	return gcm.Seal(header, nonce, record, nil), nil
+}
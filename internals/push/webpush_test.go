@@ -0,0 +1,277 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 8291 section 5.
+const (
+	rfcPlaintext     = "When I grow up, I want to be a watermelon"
+	rfcServerPrivate = "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"
+	rfcUAPrivate     = "q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94"
+	rfcUAPublic      = "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"
+	rfcAuthSecret    = "BTBZMqHH6r4Tts7J_aSIgg"
+	rfcSalt          = "DGv6ra1nlYgDCS1FRnbzlw"
+	rfcBody          = "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+)
+
+func TestEncryptRFC8291(t *testing.T) {
+	rawServerKey, _ := b64.DecodeString(rfcServerPrivate)
+	serverKey, err := ecdh.P256().NewPrivateKey(rawServerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt, _ := b64.DecodeString(rfcSalt)
+	sub := Subscription{Endpoint: "https://push.example.net/x", P256dh: rfcUAPublic, Auth: rfcAuthSecret}
+
+	body, err := encrypt(sub, []byte(rfcPlaintext), serverKey, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b64.EncodeToString(body); got != rfcBody {
+		t.Fatalf("encrypt =\n%s\nwant\n%s", got, rfcBody)
+	}
+}
+
+func TestEncryptRejectsBadKeys(t *testing.T) {
+	for _, sub := range []Subscription{
+		{P256dh: "not base64!", Auth: rfcAuthSecret},
+		{P256dh: b64.EncodeToString(make([]byte, 65)), Auth: rfcAuthSecret},
+		{P256dh: rfcUAPublic, Auth: b64.EncodeToString(make([]byte, 8))},
+	} {
+		if _, err := Encrypt(sub, []byte("hi")); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Encrypt(%+v) err = %v, want ErrInvalidKey", sub, err)
+		}
+		if err := ValidateKeys(sub.P256dh, sub.Auth); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("ValidateKeys(%+v) err = %v, want ErrInvalidKey", sub, err)
+		}
+	}
+	if err := ValidateKeys(rfcUAPublic, rfcAuthSecret); err != nil {
+		t.Errorf("ValidateKeys of the RFC keys: %v", err)
+	}
+}
+
+func TestWebPushClientSend(t *testing.T) {
+	vapid := newTestVAPID(t)
+	statuses := map[string]int{
+		"/ok":      http.StatusCreated,
+		"/missing": http.StatusNotFound,
+		"/gone":    http.StatusGone,
+		"/big":     http.StatusRequestEntityTooLarge,
+		"/broken":  http.StatusInternalServerError,
+	}
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := checkVAPID(r, vapid); err != nil {
+			t.Errorf("%s: %v", r.URL.Path, err)
+		}
+		for header, want := range map[string]string{
+			"Content-Encoding": "aes128gcm",
+			"TTL":              "60",
+			"Topic":            "abc",
+			"Urgency":          "high",
+		} {
+			if got := r.Header.Get(header); got != want {
+				t.Errorf("%s: %s = %q, want %q", r.URL.Path, header, got, want)
+			}
+		}
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(statuses[r.URL.Path])
+	}))
+	defer server.Close()
+
+	client := NewWebPushClient(vapid, server.Client())
+	msg := Message{Payload: []byte(`{"title":"hi"}`), TTL: time.Minute, Topic: "abc", Urgency: "high"}
+	send := func(path string) error {
+		sub := Subscription{Endpoint: server.URL + path, P256dh: rfcUAPublic, Auth: rfcAuthSecret}
+		return client.Send(context.Background(), sub, msg)
+	}
+
+	if err := send("/ok"); err != nil {
+		t.Fatalf("201: %v", err)
+	}
+	plaintext, err := decryptForTest(received, rfcUAPrivate, rfcAuthSecret)
+	if err != nil {
+		t.Fatal("decrypting what the push service received:", err)
+	}
+	if !bytes.Equal(plaintext, msg.Payload) {
+		t.Fatalf("push service received %q, want %q", plaintext, msg.Payload)
+	}
+
+	for _, path := range []string{"/missing", "/gone"} {
+		if err := send(path); !errors.Is(err, ErrSubscriptionGone) {
+			t.Errorf("%s: err = %v, want ErrSubscriptionGone", path, err)
+		}
+	}
+	if err := send("/big"); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("413: err = %v, want ErrPayloadTooLarge", err)
+	}
+	if err := send("/broken"); err == nil || errors.Is(err, ErrSubscriptionGone) {
+		t.Errorf("500: err = %v, want a plain error", err)
+	}
+
+	msg.Payload = make([]byte, MaxPayload+1)
+	if err := send("/ok"); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("oversized payload: err = %v, want ErrPayloadTooLarge", err)
+	}
+}
+
+func TestEndpointPolicy(t *testing.T) {
+	policy := EndpointPolicy{}
+	ctx := context.Background()
+	for _, endpoint := range []string{
+		"http://push.example.com/x",
+		"https://127.0.0.1/x",
+		"https://10.1.2.3/x",
+		"https://169.254.169.254/latest/meta-data",
+		"https://[::1]/x",
+		"https://[::ffff:192.168.0.1]/x",
+		"https://user@203.0.113.1/x",
+		"not a url",
+	} {
+		if err := policy.Check(ctx, endpoint); err == nil {
+			t.Errorf("Check(%q) accepted it", endpoint)
+		}
+	}
+	if err := policy.Check(ctx, "https://8.8.8.8/push"); err != nil {
+		t.Errorf("Check of a public address: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer server.Close()
+
+	if _, err := policy.HTTPClient(time.Second).Get(server.URL); !errors.Is(err, ErrForbiddenEndpoint) {
+		t.Errorf("dialing loopback: err = %v, want ErrForbiddenEndpoint", err)
+	}
+	resp, err := EndpointPolicy{AllowPrivate: true}.HTTPClient(time.Second).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("redirect was followed, got status %d", resp.StatusCode)
+	}
+}
+
+func newTestVAPID(t *testing.T) *VAPID {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vapid, err := ParseVAPID(b64.EncodeToString(key.Bytes()), "mailto:ops@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vapid
+}
+
+// checkVAPID verifies the Authorization header like a push service would.
+func checkVAPID(r *http.Request, vapid *VAPID) error {
+	token, key, ok := strings.Cut(strings.TrimPrefix(r.Header.Get("Authorization"), "vapid t="), ", k=")
+	if !ok || key != vapid.PublicKey() {
+		return errors.New("malformed Authorization header")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed token")
+	}
+	signature, err := b64.DecodeString(parts[2])
+	if err != nil || len(signature) != 64 {
+		return errors.New("malformed signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	rs, ss := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(&vapid.key.PublicKey, digest[:], rs, ss) {
+		return errors.New("bad signature")
+	}
+
+	rawClaims, err := b64.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	var claims struct {
+		Aud string `json:"aud"`
+		Exp int64  `json:"exp"`
+		Sub string `json:"sub"`
+	}
+	if err := json.Unmarshal(rawClaims, &claims); err != nil {
+		return err
+	}
+	if claims.Aud != "http://"+r.Host || claims.Sub != vapid.Subject || claims.Exp <= time.Now().Unix() {
+		return errors.New("unexpected claims")
+	}
+	return nil
+}
+
+// decryptForTest undoes encrypt from the user agent's side (RFC 8291).
+func decryptForTest(body []byte, uaPrivate, auth string) ([]byte, error) {
+	rawUAKey, _ := b64.DecodeString(uaPrivate)
+	uaKey, err := ecdh.P256().NewPrivateKey(rawUAKey)
+	if err != nil {
+		return nil, err
+	}
+	authSecret, _ := b64.DecodeString(auth)
+	if len(body) < headerSize || binary.BigEndian.Uint32(body[16:20]) != recordSize || body[20] != 65 {
+		return nil, errors.New("malformed header")
+	}
+	salt, rawServerKey := body[:16], body[21:headerSize]
+	serverKey, err := ecdh.P256().NewPublicKey(rawServerKey)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := uaKey.ECDH(serverKey)
+	if err != nil {
+		return nil, err
+	}
+
+	info := append([]byte("WebPush: info\x00"), uaKey.PublicKey().Bytes()...)
+	info = append(info, rawServerKey...)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, authSecret, string(info), 32)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	record, err := gcm.Open(nil, nonce, body[headerSize:], nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(record) == 0 || record[len(record)-1] != 0x02 {
+		return nil, errors.New("missing last-record delimiter")
+	}
+	return record[:len(record)-1], nil
+}
@@ -15,15 +15,29 @@ func SetupRoutes(app *app.Application) *chi.Mux {
 			"http://localhost:5500",
 		},
 		AllowedMethods: []string{
-			"GET", "POST", "OPTIONS",
+			"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS",
 		},
 		AllowedHeaders: []string{
 			"Accept",
 			"Authorization",
 			"Content-Type",
+			"Tus-Resumable",
+			"Upload-Length",
+			"Upload-Metadata",
+			"Upload-Offset",
 		},
 		ExposedHeaders: []string{
+			"Content-Location",
 			"Link",
+			"Location",
+			"Tus-Resumable",
+			"Tus-Version",
+			"Tus-Extension",
+			"Tus-Max-Size",
+			"Upload-Expires",
+			"Upload-Id",
+			"Upload-Length",
+			"Upload-Offset",
 		},
 		AllowCredentials: true,
 		MaxAge:           300,
@@ -32,6 +46,53 @@ func SetupRoutes(app *app.Application) *chi.Mux {
 		r.Use(app.UserMiddlewareHandler.Authenticate)
 		r.Post("/socket-token", app.UserHandler.WebsocketTokenHandler)
 
+		r.Get("/conversations", app.UserMiddlewareHandler.RequireUser(app.ConversationHandler.HandleGetConversations))
+		r.Post("/conversations/direct", app.UserMiddlewareHandler.RequireUser(app.ConversationHandler.HandleCreateDirectConversation))
+		r.Post("/conversations/group", app.UserMiddlewareHandler.RequireUser(app.ConversationHandler.HandleCreateGroupConversation))
+		r.Patch("/conversations/{id}", app.UserMiddlewareHandler.RequireUser(app.ConversationHandler.HandleRenameGroup))
+		r.Get("/conversations/{id}/members", app.UserMiddlewareHandler.RequireUser(app.ConversationHandler.HandleGetMembers))
+		r.Post("/conversations/{id}/members", app.UserMiddlewareHandler.RequireUser(app.ConversationHandler.HandleAddMembers))
+		r.Patch("/conversations/{id}/members/{userID}", app.UserMiddlewareHandler.RequireUser(app.ConversationHandler.HandleSetMemberRole))
+		r.Delete("/conversations/{id}/members/{userID}", app.UserMiddlewareHandler.RequireUser(app.ConversationHandler.HandleRemoveMember))
+		r.Post("/conversations/{id}/leave", app.UserMiddlewareHandler.RequireUser(app.ConversationHandler.HandleLeaveGroup))
+		r.Get("/conversations/{id}/invites", app.UserMiddlewareHandler.RequireUser(app.InviteHandler.HandleGetInvites))
+		r.Post("/conversations/{id}/invites", app.UserMiddlewareHandler.RequireUser(app.InviteHandler.HandleCreateInvite))
+		r.Delete("/conversations/{id}/invites/{inviteID}", app.UserMiddlewareHandler.RequireUser(app.InviteHandler.HandleRevokeInvite))
+		r.Get("/conversations/{id}/join-requests", app.UserMiddlewareHandler.RequireUser(app.InviteHandler.HandleGetJoinRequests))
+		r.Post("/conversations/{id}/join-requests/{userID}/approve", app.UserMiddlewareHandler.RequireUser(app.InviteHandler.HandleApproveJoinRequest))
+		r.Delete("/conversations/{id}/join-requests/{userID}", app.UserMiddlewareHandler.RequireUser(app.InviteHandler.HandleRejectJoinRequest))
+		r.Post("/invites/{code}/join", app.UserMiddlewareHandler.RequireUser(app.InviteHandler.HandleJoin))
+		r.Get("/conversations/{id}/messages", app.UserMiddlewareHandler.RequireUser(app.MessageHandler.HandleGetConversationMessages))
+		r.Get("/conversations/{id}/notifications", app.UserMiddlewareHandler.RequireUser(app.ConversationHandler.HandleGetNotificationSettings))
+		r.Put("/conversations/{id}/notifications", app.UserMiddlewareHandler.RequireUser(app.ConversationHandler.HandleUpdateNotificationSettings))
+		r.Get("/conversations/{id}/unread", app.UserMiddlewareHandler.RequireUser(app.MessageHandler.HandleGetUnreadCounts))
+		r.Get("/conversations/{id}/pins", app.UserMiddlewareHandler.RequireUser(app.MessageHandler.HandleGetPins))
+		r.Post("/conversations/{id}/pins", app.UserMiddlewareHandler.RequireUser(app.MessageHandler.HandlePinMessage))
+		r.Delete("/conversations/{id}/pins/{messageID}", app.UserMiddlewareHandler.RequireUser(app.MessageHandler.HandleUnpinMessage))
+		r.Patch("/messages/{id}", app.UserMiddlewareHandler.RequireUser(app.MessageHandler.HandleEditMessage))
+		r.Delete("/messages/{id}", app.UserMiddlewareHandler.RequireUser(app.MessageHandler.HandleDeleteMessage))
+		r.Post("/messages/{id}/reactions", app.UserMiddlewareHandler.RequireUser(app.MessageHandler.HandleAddReaction))
+		r.Delete("/messages/{id}/reactions/{emoji}", app.UserMiddlewareHandler.RequireUser(app.MessageHandler.HandleRemoveReaction))
+		r.Get("/messages/{id}/revisions", app.UserMiddlewareHandler.RequireUser(app.MessageHandler.HandleGetMessageRevisions))
+		r.Get("/messages/{id}/thread", app.UserMiddlewareHandler.RequireUser(app.MessageHandler.HandleGetThread))
+		r.Post("/messages/{id}/thread/read", app.UserMiddlewareHandler.RequireUser(app.MessageHandler.HandleMarkThreadRead))
+		r.Post("/uploads", app.UserMiddlewareHandler.RequireUser(app.UploadHandler.HandleCreateUpload))
+		r.Post("/uploads/resumable", app.UserMiddlewareHandler.RequireUser(app.ResumableUploadHandler.HandleCreate))
+		r.Head("/uploads/resumable/{id}", app.UserMiddlewareHandler.RequireUser(app.ResumableUploadHandler.HandleHead))
+		r.Patch("/uploads/resumable/{id}", app.UserMiddlewareHandler.RequireUser(app.ResumableUploadHandler.HandlePatch))
+		r.Delete("/uploads/resumable/{id}", app.UserMiddlewareHandler.RequireUser(app.ResumableUploadHandler.HandleDelete))
+		r.Get("/uploads/{id}", app.UserMiddlewareHandler.RequireUser(app.UploadHandler.HandleDownloadUpload))
+		r.Get("/uploads/{id}/thumbnails/{size}", app.UserMiddlewareHandler.RequireUser(app.UploadHandler.HandleDownloadThumbnail))
+		r.Get("/search/messages", app.UserMiddlewareHandler.RequireUser(app.MessageHandler.HandleSearchMessages))
+		r.Get("/sync", app.UserMiddlewareHandler.RequireUser(app.SyncHandler.HandleSync))
+		r.Get("/users/{id}/presence", app.UserMiddlewareHandler.RequireUser(app.PresenceHandler.HandleGetPresence))
+		r.Get("/push/vapid-public-key", app.UserMiddlewareHandler.RequireUser(app.PushHandler.HandleGetVAPIDPublicKey))
+		r.Get("/push/subscriptions", app.UserMiddlewareHandler.RequireUser(app.PushHandler.HandleGetSubscriptions))
+		r.Post("/push/subscriptions", app.UserMiddlewareHandler.RequireUser(app.PushHandler.HandleCreateSubscription))
+		r.Delete("/push/subscriptions/{id}", app.UserMiddlewareHandler.RequireUser(app.PushHandler.HandleDeleteSubscription))
+		r.Get("/users/blocked", app.UserMiddlewareHandler.RequireUser(app.BlockHandler.HandleGetBlockedUsers))
+		r.Post("/users/{id}/block", app.UserMiddlewareHandler.RequireUser(app.BlockHandler.HandleBlockUser))
+		r.Delete("/users/{id}/block", app.UserMiddlewareHandler.RequireUser(app.BlockHandler.HandleUnblockUser))
 	})
 	router.Group(func(r chi.Router) {
 		r.Use(app.WebSocketMiddlewareHandler.AuthenticateWebsockets)
@@ -39,6 +100,7 @@ func SetupRoutes(app *app.Application) *chi.Mux {
 
 	})
 	router.Get("/health", app.HealthCheck)
+	router.Options("/uploads/resumable", app.ResumableUploadHandler.HandleOptions)
 	router.Route("/auth", func(r chi.Router) {
 		r.Post("/register/verify-otp", app.UserHandler.VerifyOTPAndCreateUserHandler)
 
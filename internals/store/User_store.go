@@ -11,13 +11,14 @@ import (
 )
 
 type User struct {
-	ID        uuid.UUID `json:"id"`
-	UserName  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"`
-	Scope     string    `json:"scope"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        uuid.UUID  `json:"id"`
+	UserName  string     `json:"username"`
+	Email     string     `json:"email"`
+	Password  string     `json:"-"`
+	Scope     string     `json:"scope"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	LastSeen  *time.Time `json:"last_seen_at,omitempty"`
 }
 
 var AnonymousUser = &User{}
@@ -36,6 +37,7 @@ type UserStore interface {
 	GetUserByUserNameOrEmail(value string) (*User, error)
 	GetUserToken(scope, tokenPlainText string) (*User, error)
 	GetUserById(userId uuid.UUID) (*User, error)
+	UpdateLastSeen(userId uuid.UUID, lastSeen time.Time) error
 }
 
 func NewUserStore(db *sql.DB) *PostgresUserStore {
@@ -94,7 +96,7 @@ func (pg *PostgresUserStore) IsUniqueUsernameOrEmail(
 
 func (pg *PostgresUserStore) GetUserByUserNameOrEmail(value string) (*User, error) {
 	query := `
-		SELECT id, username, email, password_hash, scope, created_at, updated_at
+		SELECT id, username, email, password_hash, scope, created_at, updated_at, last_seen_at
 		FROM users
 		WHERE email = $1 OR username = $1
 		LIMIT 1
@@ -110,6 +112,7 @@ func (pg *PostgresUserStore) GetUserByUserNameOrEmail(value string) (*User, erro
 		&user.Scope,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.LastSeen,
 	)
 
 	if err != nil {
@@ -126,12 +129,12 @@ func (pg *PostgresUserStore) GetUserToken(scope, tokenPlainText string) (*User,
 	tokenHash := sha256.Sum256([]byte(tokenPlainText))
 	tokenHashHex := hex.EncodeToString(tokenHash[:])
 	query := `
-	 SELECT u.id, u.username, u.email, u.password_hash, u.scope, u.created_at, u.updated_at FROM users u
+	 SELECT u.id, u.username, u.email, u.password_hash, u.scope, u.created_at, u.updated_at, u.last_seen_at FROM users u
 	 INNER JOIN tokens t on t.user_id = u.id
 	 WHERE t.hash = $1 AND t.scope = $2 AND t.expiry > $3
 	`
 	user := &User{}
-	err := pg.DB.QueryRow(query, tokenHashHex, scope, time.Now()).Scan(&user.ID, &user.UserName, &user.Email, &user.Password, &user.Scope, &user.CreatedAt, &user.UpdatedAt)
+	err := pg.DB.QueryRow(query, tokenHashHex, scope, time.Now()).Scan(&user.ID, &user.UserName, &user.Email, &user.Password, &user.Scope, &user.CreatedAt, &user.UpdatedAt, &user.LastSeen)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -145,7 +148,7 @@ func (pg *PostgresUserStore) GetUserToken(scope, tokenPlainText string) (*User,
 func (pg *PostgresUserStore) GetUserById(userId uuid.UUID) (*User, error) {
 	query := `
 		SELECT u.id, u.username, u.email, u.password_hash, u.scope,
-		       u.created_at, u.updated_at
+		       u.created_at, u.updated_at, u.last_seen_at
 		FROM users u
 		WHERE u.id = $1
 	`
@@ -159,6 +162,7 @@ func (pg *PostgresUserStore) GetUserById(userId uuid.UUID) (*User, error) {
 		&user.Scope,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.LastSeen,
 	)
 
 	if err == sql.ErrNoRows {
@@ -170,3 +174,12 @@ func (pg *PostgresUserStore) GetUserById(userId uuid.UUID) (*User, error) {
 
 	return user, nil
 }
+
+func (pg *PostgresUserStore) UpdateLastSeen(userId uuid.UUID, lastSeen time.Time) error {
+	query := `
+	UPDATE users SET last_seen_at = $2
+	WHERE id = $1 AND (last_seen_at IS NULL OR last_seen_at < $2)
+	`
+	_, err := pg.DB.Exec(query, userId, lastSeen)
+	return err
+}
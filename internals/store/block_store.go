@@ -0,0 +1,127 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrSelfBlock   = errors.New("cannot block yourself")
+	ErrUserBlocked = errors.New("cannot start a conversation with this user")
+)
+
+type BlockedUser struct {
+	UserID    uuid.UUID `json:"user_id" db:"blocked_id"`
+	Username  string    `json:"username" db:"username"`
+	BlockedAt time.Time `json:"blocked_at" db:"created_at"`
+}
+
+type PostgresBlockStore struct {
+	DB *sql.DB
+}
+
+func NewPostgresBlockStore(db *sql.DB) *PostgresBlockStore {
+	return &PostgresBlockStore{
+		DB: db,
+	}
+}
+
+type BlockStore interface {
+	BlockUser(ctx context.Context, blockerID uuid.UUID, blockedID uuid.UUID) error
+	UnblockUser(ctx context.Context, blockerID uuid.UUID, blockedID uuid.UUID) error
+	GetBlockedUsers(ctx context.Context, userID uuid.UUID) ([]BlockedUser, error)
+	GetBlockedIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+	GetBlockerIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+	HasBlocked(ctx context.Context, blockerID uuid.UUID, blockedID uuid.UUID) (bool, error)
+}
+
+// BlockUser is idempotent; blocking someone twice keeps the first time.
+func (pg *PostgresBlockStore) BlockUser(ctx context.Context, blockerID uuid.UUID, blockedID uuid.UUID) error {
+	if blockerID == blockedID {
+		return ErrSelfBlock
+	}
+	query := `
+	INSERT INTO user_blocks (blocker_id, blocked_id)
+	VALUES ($1, $2)
+	ON CONFLICT DO NOTHING
+	`
+	_, err := pg.DB.ExecContext(ctx, query, blockerID, blockedID)
+	return err
+}
+
+func (pg *PostgresBlockStore) UnblockUser(ctx context.Context, blockerID uuid.UUID, blockedID uuid.UUID) error {
+	query := `
+	DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2
+	`
+	_, err := pg.DB.ExecContext(ctx, query, blockerID, blockedID)
+	return err
+}
+
+// GetBlockedUsers lists who userID has blocked, most recent first.
+func (pg *PostgresBlockStore) GetBlockedUsers(ctx context.Context, userID uuid.UUID) ([]BlockedUser, error) {
+	query := `
+	SELECT b.blocked_id, u.username, b.created_at
+	FROM user_blocks b
+	INNER JOIN users u ON u.id = b.blocked_id
+	WHERE b.blocker_id = $1
+	ORDER BY b.created_at DESC
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocked := []BlockedUser{}
+	for rows.Next() {
+		var b BlockedUser
+		if err := rows.Scan(&b.UserID, &b.Username, &b.BlockedAt); err != nil {
+			return nil, err
+		}
+		blocked = append(blocked, b)
+	}
+	return blocked, rows.Err()
+}
+
+// GetBlockedIDs returns the users userID has blocked.
+func (pg *PostgresBlockStore) GetBlockedIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	return queryUUIDs(ctx, pg.DB, `SELECT blocked_id FROM user_blocks WHERE blocker_id = $1`, userID)
+}
+
+// GetBlockerIDs returns the users who have blocked userID.
+func (pg *PostgresBlockStore) GetBlockerIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	return queryUUIDs(ctx, pg.DB, `SELECT blocker_id FROM user_blocks WHERE blocked_id = $1`, userID)
+}
+
+func (pg *PostgresBlockStore) HasBlocked(ctx context.Context, blockerID uuid.UUID, blockedID uuid.UUID) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2
+	)
+	`
+	var exists bool
+	err := pg.DB.QueryRowContext(ctx, query, blockerID, blockedID).Scan(&exists)
+	return exists, err
+}
+
+func queryUUIDs(ctx context.Context, q queryer, query string, args ...any) ([]uuid.UUID, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,6 +16,17 @@ const (
 	ConversationTypeGroup  ConversationType = "group"
 )
 
+const (
+	ParticipantRoleAdmin  = "admin"
+	ParticipantRoleMember = "member"
+)
+
+var (
+	ErrSelfConversation     = errors.New("cannot start a conversation with yourself")
+	ErrNoParticipants       = errors.New("group needs at least one other participant")
+	ErrConversationNotFound = errors.New("conversation not found")
+)
+
 type Conversation struct {
 	ID        uuid.UUID        `json:"id" db:"id"`
 	Type      ConversationType `json:"type" db:"type"`
@@ -44,21 +56,378 @@ func NewPostgresConversationStore(db *sql.DB) *PostgresConversationStore {
 }
 
 type ConversationStore interface {
-	FindOrCreateDirectConversation(ctx context.Context, user1ID uuid.UUID, user2ID uuid.UUID) *Conversation
+	FindOrCreateDirectConversation(ctx context.Context, user1ID uuid.UUID, user2ID uuid.UUID) (*Conversation, error)
 	CreateGroupConversation(ctx context.Context, name string, creatorID uuid.UUID, participantIDs []uuid.UUID) (*Conversation, error)
-	GetConversationsByUserID(ctx context.Context, userID uuid.UUID) (*ConversationWithDetails, error)
+	GetConversationsByUserID(ctx context.Context, userID uuid.UUID) ([]ConversationWithDetails, error)
+	GetConversation(ctx context.Context, conversationID uuid.UUID) (*Conversation, error)
 	GetConversationParticipants(ctx context.Context, conversationID uuid.UUID) ([]uuid.UUID, error)
+	IsParticipant(ctx context.Context, conversationID uuid.UUID, userID uuid.UUID) (bool, error)
+	GetConversationPeers(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+	GetConversationMembers(ctx context.Context, conversationID uuid.UUID) ([]ConversationParticipant, error)
+	AddMembers(ctx context.Context, conversationID uuid.UUID, actorID uuid.UUID, userIDs []uuid.UUID) (*GroupChange, error)
+	RemoveMember(ctx context.Context, conversationID uuid.UUID, actorID uuid.UUID, userID uuid.UUID) (*GroupChange, error)
+	SetMemberRole(ctx context.Context, conversationID uuid.UUID, actorID uuid.UUID, userID uuid.UUID, role string) (*GroupChange, error)
+	RenameGroup(ctx context.Context, conversationID uuid.UUID, actorID uuid.UUID, name string) (*GroupChange, error)
+	LeaveGroup(ctx context.Context, conversationID uuid.UUID, userID uuid.UUID) (*GroupChange, error)
+	GetNotificationSettings(ctx context.Context, conversationID uuid.UUID, userID uuid.UUID) (*NotificationSettings, error)
+	UpdateNotificationSettings(ctx context.Context, conversationID uuid.UUID, userID uuid.UUID, settings NotificationSettings) (*NotificationSettings, error)
+	GetParticipantNotificationSettings(ctx context.Context, conversationID uuid.UUID, userIDs []uuid.UUID) (map[uuid.UUID]NotificationSettings, error)
 }
 
-func (pg *PostgresConversationStore) FindOrCreateDirectConversation(ctx context.Context, user1ID uuid.UUID, user2ID uuid.UUID) *Conversation {
-	return nil
+func (pg *PostgresConversationStore) FindOrCreateDirectConversation(ctx context.Context, user1ID uuid.UUID, user2ID uuid.UUID) (*Conversation, error) {
+	if user1ID == user2ID {
+		return nil, ErrSelfConversation
+	}
+
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Serialize creation for this pair of users so two concurrent requests
+	// can't both miss the lookup and insert duplicate direct chats.
+	a, b := user1ID.String(), user2ID.String()
+	if a > b {
+		a, b = b, a
+	}
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "direct:"+a+":"+b)
+	if err != nil {
+		return nil, err
+	}
+
+	// Either side blocking the other closes the direct chat between them.
+	var blocked bool
+	err = tx.QueryRowContext(ctx, `
+	SELECT EXISTS (
+		SELECT 1 FROM user_blocks
+		WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+	)
+	`, user1ID, user2ID).Scan(&blocked)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrUserBlocked
+	}
+
+	query := `
+	SELECT c.id, c.type, c.name, c.created_by, c.created_at, c.updated_at
+	FROM conversation_participants p1
+	INNER JOIN conversation_participants p2
+		ON p2.conversation_id = p1.conversation_id AND p2.user_id = $2
+	INNER JOIN conversations c ON c.id = p1.conversation_id
+	WHERE p1.user_id = $1 AND c.type = 'direct'
+	LIMIT 1
+	`
+	conversation := &Conversation{}
+	err = tx.QueryRowContext(ctx, query, user1ID, user2ID).Scan(
+		&conversation.ID,
+		&conversation.Type,
+		&conversation.Name,
+		&conversation.CreatedBy,
+		&conversation.CreatedAt,
+		&conversation.UpdatedAt,
+	)
+	if err == nil {
+		return conversation, tx.Commit()
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	conversation, err = insertConversation(ctx, tx, ConversationTypeDirect, nil, user1ID)
+	if err != nil {
+		return nil, err
+	}
+	seq, err := nextConversationSeq(ctx, tx, conversation.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = insertParticipants(ctx, tx, conversation.ID, []uuid.UUID{user1ID, user2ID}, ParticipantRoleMember, seq)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return conversation, nil
 }
+
 func (pg *PostgresConversationStore) CreateGroupConversation(ctx context.Context, name string, creatorID uuid.UUID, participantIDs []uuid.UUID) (*Conversation, error) {
-	return nil, nil
+	members := make([]uuid.UUID, 0, len(participantIDs))
+	seen := map[uuid.UUID]bool{creatorID: true}
+	for _, id := range participantIDs {
+		if !seen[id] {
+			seen[id] = true
+			members = append(members, id)
+		}
+	}
+	if len(members) == 0 {
+		return nil, ErrNoParticipants
+	}
+
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	conversation, err := insertConversation(ctx, tx, ConversationTypeGroup, &name, creatorID)
+	if err != nil {
+		return nil, err
+	}
+	seq, err := nextConversationSeq(ctx, tx, conversation.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = insertParticipants(ctx, tx, conversation.ID, []uuid.UUID{creatorID}, ParticipantRoleAdmin, seq)
+	if err != nil {
+		return nil, err
+	}
+	err = insertParticipants(ctx, tx, conversation.ID, members, ParticipantRoleMember, seq)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return conversation, nil
 }
-func (pg *PostgresConversationStore) GetConversationsByUserID(ctx context.Context, userID uuid.UUID) (*ConversationWithDetails, error) {
-	return nil, nil
+
+func (pg *PostgresConversationStore) GetConversationsByUserID(ctx context.Context, userID uuid.UUID) ([]ConversationWithDetails, error) {
+	query := `
+	SELECT c.id, c.type, c.name, c.created_by, c.created_at, c.updated_at,
+		(
+			SELECT COUNT(*) FROM conversation_participants cp
+			WHERE cp.conversation_id = c.id AND cp.left_at IS NULL
+		) AS participant_count,
+		(
+			SELECT COUNT(*) FROM message_status ms
+			INNER JOIN messages m ON m.id = ms.message_id
+			WHERE m.conversation_id = c.id AND ms.user_id = $1 AND ms.status != 'read'
+				AND m.deleted_at IS NULL AND ` + notHiddenFor("$1") + `
+		) AS unread_count,
+		(
+			SELECT COUNT(*) FROM message_mentions mm
+			INNER JOIN messages m ON m.id = mm.message_id
+			WHERE m.conversation_id = c.id AND mm.user_id = $1 AND ` + unreadMention + `
+		) AS unread_mention_count,
+		p.notification_level, p.muted_until,
+		lm.id, lm.sender_id, lm.content, lm.message_type, lm.created_at
+	FROM conversation_participants p
+	INNER JOIN conversations c ON c.id = p.conversation_id
+	LEFT JOIN LATERAL (
+		SELECT m.id, m.sender_id,
+			CASE WHEN m.deleted_at IS NULL THEN m.content END AS content,
+			m.message_type, m.created_at
+		FROM messages m
+		WHERE m.conversation_id = c.id AND m.thread_root_id IS NULL
+			AND ` + notHiddenFor("$1") + `
+		ORDER BY m.created_at DESC
+		LIMIT 1
+	) lm ON true
+	WHERE p.user_id = $1 AND p.left_at IS NULL
+	ORDER BY COALESCE(lm.created_at, c.updated_at) DESC
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []ConversationWithDetails{}
+	for rows.Next() {
+		var (
+			details       ConversationWithDetails
+			lastID        *uuid.UUID
+			lastSenderID  *uuid.UUID
+			lastContent   sql.NullString
+			lastType      sql.NullString
+			lastCreatedAt sql.NullTime
+		)
+		err := rows.Scan(
+			&details.ID,
+			&details.Type,
+			&details.Name,
+			&details.CreatedBy,
+			&details.CreatedAt,
+			&details.UpdatedAt,
+			&details.ParticipantCount,
+			&details.UnreadCount,
+			&details.UnreadMentionCount,
+			&details.Level,
+			&details.MutedUntil,
+			&lastID,
+			&lastSenderID,
+			&lastContent,
+			&lastType,
+			&lastCreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if lastID != nil {
+			details.LastMessage = &Message{
+				ID:             *lastID,
+				ConversationID: details.ID,
+				Content:        lastContent.String,
+				MessageType:    MessageType(lastType.String),
+				CreatedAt:      lastCreatedAt.Time,
+			}
+			if lastSenderID != nil {
+				details.LastMessage.SenderID = *lastSenderID
+			}
+		}
+		conversations = append(conversations, details)
+	}
+	return conversations, rows.Err()
+}
+
+func (pg *PostgresConversationStore) GetConversation(ctx context.Context, conversationID uuid.UUID) (*Conversation, error) {
+	return getConversation(ctx, pg.DB, conversationID)
+}
+
+// rowQueryer is satisfied by both *sql.DB and *sql.Tx.
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 }
+
+func getConversation(ctx context.Context, q rowQueryer, conversationID uuid.UUID) (*Conversation, error) {
+	query := `
+	SELECT id, type, name, created_by, created_at, updated_at
+	FROM conversations
+	WHERE id = $1
+	`
+	conversation := &Conversation{}
+	err := q.QueryRowContext(ctx, query, conversationID).Scan(
+		&conversation.ID,
+		&conversation.Type,
+		&conversation.Name,
+		&conversation.CreatedBy,
+		&conversation.CreatedAt,
+		&conversation.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return conversation, nil
+}
+
 func (pg *PostgresConversationStore) GetConversationParticipants(ctx context.Context, conversationID uuid.UUID) ([]uuid.UUID, error) {
-	return nil, nil
+	query := `
+	SELECT user_id FROM conversation_participants
+	WHERE conversation_id = $1 AND left_at IS NULL
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var participants []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		participants = append(participants, id)
+	}
+	return participants, rows.Err()
+}
+
+func (pg *PostgresConversationStore) IsParticipant(ctx context.Context, conversationID uuid.UUID, userID uuid.UUID) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM conversation_participants
+		WHERE conversation_id = $1 AND user_id = $2 AND left_at IS NULL
+	)
+	`
+	var exists bool
+	err := pg.DB.QueryRowContext(ctx, query, conversationID, userID).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// GetConversationPeers returns every other user who shares at least one
+// active conversation with userID.
+func (pg *PostgresConversationStore) GetConversationPeers(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	query := `
+	SELECT DISTINCT other.user_id
+	FROM conversation_participants me
+	INNER JOIN conversation_participants other
+		ON other.conversation_id = me.conversation_id AND other.left_at IS NULL
+	WHERE me.user_id = $1 AND me.left_at IS NULL AND other.user_id != $1
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var peers []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		peers = append(peers, id)
+	}
+	return peers, rows.Err()
+}
+
+func insertConversation(ctx context.Context, tx *sql.Tx, conversationType ConversationType, name *string, createdBy uuid.UUID) (*Conversation, error) {
+	query := `
+	INSERT INTO conversations (type, name, created_by)
+	VALUES ($1, $2, $3)
+	RETURNING id, type, name, created_by, created_at, updated_at
+	`
+	conversation := &Conversation{}
+	err := tx.QueryRowContext(ctx, query, conversationType, name, createdBy).Scan(
+		&conversation.ID,
+		&conversation.Type,
+		&conversation.Name,
+		&conversation.CreatedBy,
+		&conversation.CreatedAt,
+		&conversation.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return conversation, nil
+}
+
+func insertParticipants(ctx context.Context, tx *sql.Tx, conversationID uuid.UUID, userIDs []uuid.UUID, role string, seq int64) error {
+	query := `
+	INSERT INTO conversation_participants (conversation_id, user_id, role, seq)
+	VALUES ($1, $2, $3, $4)
+	`
+	for _, userID := range userIDs {
+		if _, err := tx.ExecContext(ctx, query, conversationID, userID, role, seq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextConversationSeq takes the next change number for a conversation. The
+// row lock it takes is held until tx ends, so numbers are handed out in
+// commit order.
+func nextConversationSeq(ctx context.Context, tx *sql.Tx, conversationID uuid.UUID) (int64, error) {
+	query := `
+	UPDATE conversations
+	SET last_seq = last_seq + 1, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $1
+	RETURNING last_seq
+	`
+	var seq int64
+	err := tx.QueryRowContext(ctx, query, conversationID).Scan(&seq)
+	return seq, err
 }
@@ -7,6 +7,7 @@ import (
 	"io/fs"
 	"log"
 
+	"github.com/google/uuid"
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/pressly/goose/v3"
 )
@@ -55,3 +56,12 @@ func MigrateFS(db *sql.DB, migrationFS fs.FS, dir string) error {
 	return Migrate(db, dir)
 
 }
+
+// uuidArray converts ids into a value pgx can bind to a uuid[] parameter.
+func uuidArray(ids []uuid.UUID) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.String()
+	}
+	return out
+}
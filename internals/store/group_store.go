@@ -0,0 +1,409 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SystemMembersAdded  = "members_added"
+	SystemMemberRemoved = "member_removed"
+	SystemMemberLeft    = "member_left"
+	SystemMemberJoined  = "member_joined"
+	SystemRoleChanged   = "role_changed"
+	SystemRenamed       = "renamed"
+	// SystemAdminSuccession is posted when the last admin leaves and the
+	// longest-standing member is promoted in their place.
+	SystemAdminSuccession = "admin_succession"
+)
+
+var (
+	ErrNotGroup           = errors.New("only group conversations can be changed")
+	ErrAlreadyParticipant = errors.New("users are already participants of this conversation")
+	ErrLastAdmin          = errors.New("a group needs at least one admin")
+	ErrInvalidRole        = errors.New("role must be admin or member")
+	ErrNoChange           = errors.New("nothing to change")
+	ErrCannotRemoveSelf   = errors.New("leave the group instead of removing yourself")
+)
+
+// SystemEvent describes the group change a system message records.
+type SystemEvent struct {
+	Action  string      `json:"action"`
+	ActorID uuid.UUID   `json:"actor_id"`
+	UserIDs []uuid.UUID `json:"user_ids,omitempty"`
+	Role    string      `json:"role,omitempty"`
+	Name    string      `json:"name,omitempty"`
+}
+
+func (e *SystemEvent) Value() (driver.Value, error) {
+	if e == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (e *SystemEvent) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, e)
+	case string:
+		return json.Unmarshal([]byte(v), e)
+	default:
+		return fmt.Errorf("cannot scan %T into SystemEvent", src)
+	}
+}
+
+// GroupChange is the outcome of a group administration action: the
+// conversation as it now is, the system messages posted about it and the
+// users who lost access and should still be told.
+type GroupChange struct {
+	Conversation *Conversation `json:"conversation"`
+	Messages     []Message     `json:"messages"`
+	Removed      []uuid.UUID   `json:"-"`
+}
+
+// GetConversationMembers lists the active participants of a conversation
+// with their roles, in the order they joined.
+func (pg *PostgresConversationStore) GetConversationMembers(ctx context.Context, conversationID uuid.UUID) ([]ConversationParticipant, error) {
+	query := `
+	SELECT id, conversation_id, user_id, joined_at, left_at, role
+	FROM conversation_participants
+	WHERE conversation_id = $1 AND left_at IS NULL
+	ORDER BY joined_at, id
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []ConversationParticipant{}
+	for rows.Next() {
+		var p ConversationParticipant
+		if err := rows.Scan(&p.ID, &p.ConversationID, &p.UserID, &p.JoinedAt, &p.LeftAt, &p.Role); err != nil {
+			return nil, err
+		}
+		members = append(members, p)
+	}
+	return members, rows.Err()
+}
+
+// AddMembers adds users to a group, bringing back those who had left or
+// been removed. Users already in the group are skipped.
+func (pg *PostgresConversationStore) AddMembers(ctx context.Context, conversationID uuid.UUID, actorID uuid.UUID, userIDs []uuid.UUID) (*GroupChange, error) {
+	return changeGroup(ctx, pg.DB, conversationID, actorID, true, func(tx *sql.Tx, seq int64) ([]SystemEvent, error) {
+		added, err := upsertMembers(ctx, tx, conversationID, userIDs, seq)
+		if err != nil {
+			return nil, err
+		}
+		if len(added) == 0 {
+			return nil, ErrAlreadyParticipant
+		}
+		return []SystemEvent{{Action: SystemMembersAdded, ActorID: actorID, UserIDs: added}}, nil
+	})
+}
+
+// RemoveMember removes another member from a group.
+func (pg *PostgresConversationStore) RemoveMember(ctx context.Context, conversationID uuid.UUID, actorID uuid.UUID, userID uuid.UUID) (*GroupChange, error) {
+	if userID == actorID {
+		return nil, ErrCannotRemoveSelf
+	}
+	change, err := changeGroup(ctx, pg.DB, conversationID, actorID, true, func(tx *sql.Tx, seq int64) ([]SystemEvent, error) {
+		if err := markLeft(ctx, tx, conversationID, userID, seq); err != nil {
+			return nil, err
+		}
+		return []SystemEvent{{Action: SystemMemberRemoved, ActorID: actorID, UserIDs: []uuid.UUID{userID}}}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	change.Removed = []uuid.UUID{userID}
+	return change, nil
+}
+
+// SetMemberRole promotes a member to admin or demotes an admin to member.
+// Admins may demote themselves as long as another admin remains.
+func (pg *PostgresConversationStore) SetMemberRole(ctx context.Context, conversationID uuid.UUID, actorID uuid.UUID, userID uuid.UUID, role string) (*GroupChange, error) {
+	if role != ParticipantRoleAdmin && role != ParticipantRoleMember {
+		return nil, ErrInvalidRole
+	}
+	return changeGroup(ctx, pg.DB, conversationID, actorID, true, func(tx *sql.Tx, seq int64) ([]SystemEvent, error) {
+		var current string
+		err := tx.QueryRowContext(ctx, `
+		SELECT role FROM conversation_participants
+		WHERE conversation_id = $1 AND user_id = $2 AND left_at IS NULL
+		`, conversationID, userID).Scan(&current)
+		if err == sql.ErrNoRows {
+			return nil, ErrNotParticipant
+		}
+		if err != nil {
+			return nil, err
+		}
+		if current == role {
+			return nil, ErrNoChange
+		}
+		if role == ParticipantRoleMember {
+			admins, err := countAdmins(ctx, tx, conversationID)
+			if err != nil {
+				return nil, err
+			}
+			if admins <= 1 {
+				return nil, ErrLastAdmin
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `
+		UPDATE conversation_participants
+		SET role = $3, seq = $4
+		WHERE conversation_id = $1 AND user_id = $2
+		`, conversationID, userID, role, seq)
+		if err != nil {
+			return nil, err
+		}
+		return []SystemEvent{{Action: SystemRoleChanged, ActorID: actorID, UserIDs: []uuid.UUID{userID}, Role: role}}, nil
+	})
+}
+
+func (pg *PostgresConversationStore) RenameGroup(ctx context.Context, conversationID uuid.UUID, actorID uuid.UUID, name string) (*GroupChange, error) {
+	return changeGroup(ctx, pg.DB, conversationID, actorID, true, func(tx *sql.Tx, seq int64) ([]SystemEvent, error) {
+		result, err := tx.ExecContext(ctx, `
+		UPDATE conversations SET name = $2
+		WHERE id = $1 AND name IS DISTINCT FROM $2
+		`, conversationID, name)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 0 {
+			return nil, ErrNoChange
+		}
+		return []SystemEvent{{Action: SystemRenamed, ActorID: actorID, Name: name}}, nil
+	})
+}
+
+// LeaveGroup takes userID out of a group. When they were its last admin,
+// the member who has been in the group longest becomes admin.
+func (pg *PostgresConversationStore) LeaveGroup(ctx context.Context, conversationID uuid.UUID, userID uuid.UUID) (*GroupChange, error) {
+	change, err := changeGroup(ctx, pg.DB, conversationID, userID, false, func(tx *sql.Tx, seq int64) ([]SystemEvent, error) {
+		if err := markLeft(ctx, tx, conversationID, userID, seq); err != nil {
+			return nil, err
+		}
+		events := []SystemEvent{{Action: SystemMemberLeft, ActorID: userID}}
+
+		admins, err := countAdmins(ctx, tx, conversationID)
+		if err != nil || admins > 0 {
+			return events, err
+		}
+		var successor uuid.UUID
+		err = tx.QueryRowContext(ctx, `
+		UPDATE conversation_participants
+		SET role = 'admin', seq = $2
+		WHERE id = (
+			SELECT id FROM conversation_participants
+			WHERE conversation_id = $1 AND left_at IS NULL
+			ORDER BY joined_at, id
+			LIMIT 1
+		)
+		RETURNING user_id
+		`, conversationID, seq).Scan(&successor)
+		if err == sql.ErrNoRows {
+			// Nobody is left to take over.
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return append(events, SystemEvent{
+			Action:  SystemAdminSuccession,
+			ActorID: userID,
+			UserIDs: []uuid.UUID{successor},
+			Role:    ParticipantRoleAdmin,
+		}), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	change.Removed = []uuid.UUID{userID}
+	return change, nil
+}
+
+// changeGroup runs apply in a transaction after checking actorID is an
+// active participant of the group, and an admin when requireAdmin is set.
+// apply gets the change's sequence number and returns what to record in
+// the system messages posted about it, one message per event.
+func changeGroup(ctx context.Context, db *sql.DB, conversationID uuid.UUID, actorID uuid.UUID, requireAdmin bool, apply func(tx *sql.Tx, seq int64) ([]SystemEvent, error)) (*GroupChange, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Taking the sequence number first locks the conversation row, so
+	// concurrent changes to the same group run one after the other.
+	seq, err := nextConversationSeq(ctx, tx, conversationID)
+	if err == sql.ErrNoRows {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := groupRole(ctx, tx, conversationID, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if requireAdmin && role != ParticipantRoleAdmin {
+		return nil, ErrNotAdmin
+	}
+
+	events, err := apply(tx, seq)
+	if err != nil {
+		return nil, err
+	}
+	return commitGroupChange(ctx, tx, conversationID, actorID, seq, events)
+}
+
+// commitGroupChange posts a system message for each event, the first one
+// at seq, and commits tx.
+func commitGroupChange(ctx context.Context, tx *sql.Tx, conversationID uuid.UUID, actorID uuid.UUID, seq int64, events []SystemEvent) (*GroupChange, error) {
+	var err error
+	messages := make([]Message, 0, len(events))
+	for i := range events {
+		// Every message needs its own position; the first one shares the
+		// number taken for the change itself.
+		if i > 0 {
+			if seq, err = nextConversationSeq(ctx, tx, conversationID); err != nil {
+				return nil, err
+			}
+		}
+		msg, err := insertSystemMessage(ctx, tx, conversationID, actorID, &events[i], seq)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *msg)
+	}
+	conversation, err := getConversation(ctx, tx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &GroupChange{Conversation: conversation, Messages: messages}, nil
+}
+
+// groupRole returns userID's role in a group they are an active member of.
+func groupRole(ctx context.Context, q rowQueryer, conversationID uuid.UUID, userID uuid.UUID) (string, error) {
+	var (
+		conversationType ConversationType
+		role             string
+	)
+	err := q.QueryRowContext(ctx, `
+	SELECT c.type, cp.role
+	FROM conversations c
+	INNER JOIN conversation_participants cp
+		ON cp.conversation_id = c.id AND cp.user_id = $2 AND cp.left_at IS NULL
+	WHERE c.id = $1
+	`, conversationID, userID).Scan(&conversationType, &role)
+	if err == sql.ErrNoRows {
+		return "", ErrNotParticipant
+	}
+	if err != nil {
+		return "", err
+	}
+	if conversationType != ConversationTypeGroup {
+		return "", ErrNotGroup
+	}
+	return role, nil
+}
+
+// requireGroupAdmin returns nil when userID is an admin of the group.
+func requireGroupAdmin(ctx context.Context, q rowQueryer, conversationID uuid.UUID, userID uuid.UUID) error {
+	role, err := groupRole(ctx, q, conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if role != ParticipantRoleAdmin {
+		return ErrNotAdmin
+	}
+	return nil
+}
+
+func insertSystemMessage(ctx context.Context, tx *sql.Tx, conversationID uuid.UUID, actorID uuid.UUID, event *SystemEvent, seq int64) (*Message, error) {
+	query := `
+	INSERT INTO messages AS m (conversation_id, sender_id, content, message_type,
+		system_event, seq, change_seq)
+	VALUES ($1, $2, '', $3, $4, $5, $5)
+	RETURNING ` + messageColumns
+	return scanMessage(tx.QueryRowContext(ctx, query, conversationID, actorID, MessageTypeSystem, event, seq))
+}
+
+// upsertMembers makes userIDs members of a group, bringing back those who
+// had left or been removed, and returns the users who were not members
+// already.
+func upsertMembers(ctx context.Context, tx *sql.Tx, conversationID uuid.UUID, userIDs []uuid.UUID, seq int64) ([]uuid.UUID, error) {
+	rows, err := tx.QueryContext(ctx, `
+	INSERT INTO conversation_participants (conversation_id, user_id, role, seq)
+	SELECT $1, u.id, 'member', $3
+	FROM users u
+	WHERE u.id = ANY($2::uuid[])
+	ON CONFLICT (conversation_id, user_id) DO UPDATE
+	SET left_at = NULL, joined_at = CURRENT_TIMESTAMP, role = 'member', seq = EXCLUDED.seq
+	WHERE conversation_participants.left_at IS NOT NULL
+	RETURNING user_id
+	`, conversationID, uuidArray(userIDs), seq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var added []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		added = append(added, id)
+	}
+	return added, rows.Err()
+}
+
+// markLeft ends userID's active membership.
+func markLeft(ctx context.Context, tx *sql.Tx, conversationID uuid.UUID, userID uuid.UUID, seq int64) error {
+	result, err := tx.ExecContext(ctx, `
+	UPDATE conversation_participants
+	SET left_at = CURRENT_TIMESTAMP, seq = $3
+	WHERE conversation_id = $1 AND user_id = $2 AND left_at IS NULL
+	`, conversationID, userID, seq)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotParticipant
+	}
+	return nil
+}
+
+func countAdmins(ctx context.Context, tx *sql.Tx, conversationID uuid.UUID) (int, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, `
+	SELECT COUNT(*) FROM conversation_participants
+	WHERE conversation_id = $1 AND role = 'admin' AND left_at IS NULL
+	`, conversationID).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,326 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-chat/internals/tokens"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInviteNotFound      = errors.New("invite not found")
+	ErrInviteExpired       = errors.New("invite has expired")
+	ErrInviteRevoked       = errors.New("invite has been revoked")
+	ErrInviteUsedUp        = errors.New("invite has reached its use limit")
+	ErrJoinRequestNotFound = errors.New("join request not found")
+	ErrJoinRequestPending  = errors.New("a request to join this group is already pending")
+)
+
+// Invite is a shareable link that lets anyone holding its code join a
+// group, or ask to when RequiresApproval is set.
+type Invite struct {
+	ID               uuid.UUID  `json:"id" db:"id"`
+	ConversationID   uuid.UUID  `json:"conversation_id" db:"conversation_id"`
+	Code             string     `json:"code" db:"code"`
+	CreatedBy        *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	MaxUses          *int       `json:"max_uses,omitempty" db:"max_uses"`
+	UseCount         int        `json:"use_count" db:"use_count"`
+	RequiresApproval bool       `json:"requires_approval" db:"requires_approval"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+}
+
+// JoinRequest is a user waiting for an admin to let them into a group.
+type JoinRequest struct {
+	ConversationID uuid.UUID  `json:"conversation_id" db:"conversation_id"`
+	UserID         uuid.UUID  `json:"user_id" db:"user_id"`
+	InviteID       *uuid.UUID `json:"invite_id,omitempty" db:"invite_id"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
+
+type PostgresInviteStore struct {
+	DB *sql.DB
+}
+
+func NewPostgresInviteStore(db *sql.DB) *PostgresInviteStore {
+	return &PostgresInviteStore{
+		DB: db,
+	}
+}
+
+type InviteStore interface {
+	CreateInvite(ctx context.Context, invite *Invite) (*Invite, error)
+	GetInvites(ctx context.Context, conversationID uuid.UUID, userID uuid.UUID) ([]Invite, error)
+	RevokeInvite(ctx context.Context, conversationID uuid.UUID, inviteID uuid.UUID, userID uuid.UUID) (*Invite, error)
+	JoinWithInvite(ctx context.Context, code string, userID uuid.UUID) (*GroupChange, *JoinRequest, error)
+	GetJoinRequests(ctx context.Context, conversationID uuid.UUID, userID uuid.UUID) ([]JoinRequest, error)
+	ApproveJoinRequest(ctx context.Context, conversationID uuid.UUID, adminID uuid.UUID, userID uuid.UUID) (*GroupChange, error)
+	RejectJoinRequest(ctx context.Context, conversationID uuid.UUID, adminID uuid.UUID, userID uuid.UUID) error
+}
+
+const inviteColumns = `
+	id, conversation_id, code, created_by, expires_at, max_uses, use_count,
+	requires_approval, revoked_at, created_at
+`
+
+func scanInvite(row rowScanner) (*Invite, error) {
+	invite := &Invite{}
+	err := row.Scan(
+		&invite.ID,
+		&invite.ConversationID,
+		&invite.Code,
+		&invite.CreatedBy,
+		&invite.ExpiresAt,
+		&invite.MaxUses,
+		&invite.UseCount,
+		&invite.RequiresApproval,
+		&invite.RevokedAt,
+		&invite.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// CreateInvite mints a new code for invite.ConversationID on behalf of
+// invite.CreatedBy, who must be an admin of the group.
+func (pg *PostgresInviteStore) CreateInvite(ctx context.Context, invite *Invite) (*Invite, error) {
+	if err := requireGroupAdmin(ctx, pg.DB, invite.ConversationID, *invite.CreatedBy); err != nil {
+		return nil, err
+	}
+	code, err := tokens.GenerateCode()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	INSERT INTO conversation_invites (conversation_id, code, created_by, expires_at, max_uses, requires_approval)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING ` + inviteColumns
+	return scanInvite(pg.DB.QueryRowContext(ctx, query,
+		invite.ConversationID, code, invite.CreatedBy, invite.ExpiresAt, invite.MaxUses, invite.RequiresApproval))
+}
+
+// GetInvites lists a group's invites that have not been revoked, newest
+// first. Only admins may see them.
+func (pg *PostgresInviteStore) GetInvites(ctx context.Context, conversationID uuid.UUID, userID uuid.UUID) ([]Invite, error) {
+	if err := requireGroupAdmin(ctx, pg.DB, conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	query := `
+	SELECT ` + inviteColumns + `
+	FROM conversation_invites
+	WHERE conversation_id = $1 AND revoked_at IS NULL
+	ORDER BY created_at DESC
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []Invite{}
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, *invite)
+	}
+	return invites, rows.Err()
+}
+
+func (pg *PostgresInviteStore) RevokeInvite(ctx context.Context, conversationID uuid.UUID, inviteID uuid.UUID, userID uuid.UUID) (*Invite, error) {
+	if err := requireGroupAdmin(ctx, pg.DB, conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	query := `
+	UPDATE conversation_invites
+	SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP)
+	WHERE id = $1 AND conversation_id = $2
+	RETURNING ` + inviteColumns
+	invite, err := scanInvite(pg.DB.QueryRowContext(ctx, query, inviteID, conversationID))
+	if err == sql.ErrNoRows {
+		return nil, ErrInviteNotFound
+	}
+	return invite, err
+}
+
+// JoinWithInvite uses code to put userID into its group. For invites that
+// require approval a join request is filed instead and returned in place
+// of the change. Either way the invite counts one more use.
+func (pg *PostgresInviteStore) JoinWithInvite(ctx context.Context, code string, userID uuid.UUID) (*GroupChange, *JoinRequest, error) {
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// Locking the invite keeps concurrent joins from going over max_uses.
+	query := `
+	SELECT ` + inviteColumns + `
+	FROM conversation_invites
+	WHERE code = $1
+	FOR UPDATE
+	`
+	invite, err := scanInvite(tx.QueryRowContext(ctx, query, code))
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrInviteNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case invite.RevokedAt != nil:
+		return nil, nil, ErrInviteRevoked
+	case invite.ExpiresAt != nil && !invite.ExpiresAt.After(time.Now()):
+		return nil, nil, ErrInviteExpired
+	case invite.MaxUses != nil && invite.UseCount >= *invite.MaxUses:
+		return nil, nil, ErrInviteUsedUp
+	}
+
+	_, err = groupRole(ctx, tx, invite.ConversationID, userID)
+	if err == nil {
+		return nil, nil, ErrAlreadyParticipant
+	}
+	if !errors.Is(err, ErrNotParticipant) {
+		return nil, nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE conversation_invites SET use_count = use_count + 1 WHERE id = $1
+	`, invite.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if invite.RequiresApproval {
+		request := &JoinRequest{}
+		err := tx.QueryRowContext(ctx, `
+		INSERT INTO conversation_join_requests (conversation_id, user_id, invite_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (conversation_id, user_id) DO NOTHING
+		RETURNING conversation_id, user_id, invite_id, created_at
+		`, invite.ConversationID, userID, invite.ID).Scan(
+			&request.ConversationID, &request.UserID, &request.InviteID, &request.CreatedAt)
+		if err == sql.ErrNoRows {
+			return nil, nil, ErrJoinRequestPending
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, nil, err
+		}
+		return nil, request, nil
+	}
+
+	seq, err := nextConversationSeq(ctx, tx, invite.ConversationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	added, err := upsertMembers(ctx, tx, invite.ConversationID, []uuid.UUID{userID}, seq)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(added) == 0 {
+		return nil, nil, ErrAlreadyParticipant
+	}
+	// Anyone let in directly no longer needs an older pending request.
+	_, err = tx.ExecContext(ctx, `
+	DELETE FROM conversation_join_requests WHERE conversation_id = $1 AND user_id = $2
+	`, invite.ConversationID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	change, err := commitGroupChange(ctx, tx, invite.ConversationID, userID, seq, []SystemEvent{
+		{Action: SystemMemberJoined, ActorID: userID},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return change, nil, nil
+}
+
+// GetJoinRequests lists the requests waiting on a group's admins, oldest
+// first.
+func (pg *PostgresInviteStore) GetJoinRequests(ctx context.Context, conversationID uuid.UUID, userID uuid.UUID) ([]JoinRequest, error) {
+	if err := requireGroupAdmin(ctx, pg.DB, conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	query := `
+	SELECT conversation_id, user_id, invite_id, created_at
+	FROM conversation_join_requests
+	WHERE conversation_id = $1
+	ORDER BY created_at
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []JoinRequest{}
+	for rows.Next() {
+		var request JoinRequest
+		if err := rows.Scan(&request.ConversationID, &request.UserID, &request.InviteID, &request.CreatedAt); err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
+
+// ApproveJoinRequest lets userID into the group, recorded as the admin
+// adding them.
+func (pg *PostgresInviteStore) ApproveJoinRequest(ctx context.Context, conversationID uuid.UUID, adminID uuid.UUID, userID uuid.UUID) (*GroupChange, error) {
+	return changeGroup(ctx, pg.DB, conversationID, adminID, true, func(tx *sql.Tx, seq int64) ([]SystemEvent, error) {
+		if err := deleteJoinRequest(ctx, tx, conversationID, userID); err != nil {
+			return nil, err
+		}
+		added, err := upsertMembers(ctx, tx, conversationID, []uuid.UUID{userID}, seq)
+		if err != nil {
+			return nil, err
+		}
+		if len(added) == 0 {
+			return nil, ErrAlreadyParticipant
+		}
+		return []SystemEvent{{Action: SystemMembersAdded, ActorID: adminID, UserIDs: added}}, nil
+	})
+}
+
+func (pg *PostgresInviteStore) RejectJoinRequest(ctx context.Context, conversationID uuid.UUID, adminID uuid.UUID, userID uuid.UUID) error {
+	if err := requireGroupAdmin(ctx, pg.DB, conversationID, adminID); err != nil {
+		return err
+	}
+	return deleteJoinRequest(ctx, pg.DB, conversationID, userID)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func deleteJoinRequest(ctx context.Context, e execer, conversationID uuid.UUID, userID uuid.UUID) error {
+	result, err := e.ExecContext(ctx, `
+	DELETE FROM conversation_join_requests WHERE conversation_id = $1 AND user_id = $2
+	`, conversationID, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJoinRequestNotFound
+	}
+	return nil
+}
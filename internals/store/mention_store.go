@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MentionKindUser = "user"
+	MentionKindAll  = "all"
+	MentionKindHere = "here"
+)
+
+// Mention is a user mentioned in a message and how.
+type Mention struct {
+	UserID uuid.UUID `json:"user_id"`
+	Kind   string    `json:"kind"`
+}
+
+// unreadMention filters mentions mm of messages m to those the mentioned
+// user has not read yet: main timeline messages by their read receipt,
+// thread replies by how far the user has read the thread.
+const unreadMention = `m.deleted_at IS NULL
+	AND NOT EXISTS (
+		SELECT 1 FROM message_hidden h
+		WHERE h.message_id = m.id AND h.user_id = mm.user_id
+	)
+	AND CASE WHEN m.thread_root_id IS NULL THEN EXISTS (
+		SELECT 1 FROM message_status ms
+		WHERE ms.message_id = m.id AND ms.user_id = mm.user_id AND ms.status != 'read'
+	) ELSE NOT EXISTS (
+		SELECT 1 FROM thread_reads tr
+		WHERE tr.root_message_id = m.thread_root_id AND tr.user_id = mm.user_id
+			AND tr.last_read_at >= m.created_at
+	) END`
+
+// AddMentions records mentions of a message and returns the ones kept:
+// the sender mentioning themselves and users who aren't active
+// participants are dropped, and a user mentioned several ways keeps the
+// first.
+func (pg *PostgresMessageStore) AddMentions(ctx context.Context, messageID uuid.UUID, mentions []Mention) ([]Mention, error) {
+	if len(mentions) == 0 {
+		return nil, nil
+	}
+	userIDs := make([]uuid.UUID, len(mentions))
+	kinds := make([]string, len(mentions))
+	for i, mention := range mentions {
+		userIDs[i] = mention.UserID
+		kinds[i] = mention.Kind
+	}
+
+	query := `
+	INSERT INTO message_mentions (message_id, user_id, kind)
+	SELECT DISTINCT ON (x.user_id) m.id, x.user_id, x.kind
+	FROM unnest($2::uuid[], $3::text[]) WITH ORDINALITY AS x(user_id, kind, position)
+	INNER JOIN messages m ON m.id = $1
+	INNER JOIN conversation_participants cp
+		ON cp.conversation_id = m.conversation_id
+		AND cp.user_id = x.user_id AND cp.left_at IS NULL
+	WHERE x.user_id != m.sender_id
+	ORDER BY x.user_id, x.position
+	ON CONFLICT DO NOTHING
+	RETURNING user_id, kind
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, messageID, uuidArray(userIDs), kinds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var kept []Mention
+	for rows.Next() {
+		var mention Mention
+		if err := rows.Scan(&mention.UserID, &mention.Kind); err != nil {
+			return nil, err
+		}
+		kept = append(kept, mention)
+	}
+	return kept, rows.Err()
+}
+
+// GetUnreadMentionCount counts the messages in a conversation that mention
+// userID and that they haven't read.
+func (pg *PostgresMessageStore) GetUnreadMentionCount(ctx context.Context, userID uuid.UUID, conversationID uuid.UUID) (int, error) {
+	query := `
+	SELECT COUNT(*)
+	FROM message_mentions mm
+	INNER JOIN messages m ON m.id = mm.message_id
+	WHERE mm.user_id = $1 AND m.conversation_id = $2 AND ` + unreadMention
+	var count int
+	err := pg.DB.QueryRowContext(ctx, query, userID, conversationID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -3,7 +3,12 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
@@ -15,23 +20,116 @@ const (
 	MessageTypeImage MessageType = "image"
 	MessageTypeVideo MessageType = "video"
 	MessageTypeFile  MessageType = "file"
+	// MessageTypeSystem messages are posted by the server to record group
+	// changes; their SystemEvent says what happened.
+	MessageTypeSystem MessageType = "system"
 )
 
 type Message struct {
-	ID               uuid.UUID   `json:"id" db:"id"`
-	ConversationID   uuid.UUID   `json:"conversation_id" db:"conversation_id"`
-	SenderID         uuid.UUID   `json:"sender_id" db:"sender_id"`
-	Content          string      `json:"content" db:"content"`
-	MessageType      MessageType `json:"message_type" db:"message_type"`
-	MediaURL         *string     `json:"media_url,omitempty" db:"media_url"`
-	MediaSize        *int64      `json:"media_size,omitempty" db:"media_size"`
-	MediaMimeType    *string     `json:"media_mime_type,omitempty" db:"media_mime_type"`
-	ReplyToMessageID *uuid.UUID  `json:"reply_to_message_id,omitempty" db:"reply_to_message_id"`
-	CreatedAt        time.Time   `json:"created_at" db:"created_at"`
-	EditedAt         *time.Time  `json:"edited_at,omitempty" db:"edited_at"`
-	DeletedAt        *time.Time  `json:"deleted_at,omitempty" db:"deleted_at"`
+	ID               uuid.UUID    `json:"id" db:"id"`
+	ConversationID   uuid.UUID    `json:"conversation_id" db:"conversation_id"`
+	SenderID         uuid.UUID    `json:"sender_id" db:"sender_id"`
+	Content          string       `json:"content" db:"content"`
+	MessageType      MessageType  `json:"message_type" db:"message_type"`
+	MediaURL         *string      `json:"media_url,omitempty" db:"media_url"`
+	MediaSize        *int64       `json:"media_size,omitempty" db:"media_size"`
+	MediaMimeType    *string      `json:"media_mime_type,omitempty" db:"media_mime_type"`
+	MediaWidth       *int         `json:"media_width,omitempty" db:"media_width"`
+	MediaHeight      *int         `json:"media_height,omitempty" db:"media_height"`
+	Thumbnails       Thumbnails   `json:"thumbnails,omitempty" db:"media_thumbnails"`
+	ReplyToMessageID *uuid.UUID   `json:"reply_to_message_id,omitempty" db:"reply_to_message_id"`
+	ThreadRootID     *uuid.UUID   `json:"thread_root_id,omitempty" db:"thread_root_id"`
+	ReplyCount       int          `json:"reply_count" db:"reply_count"`
+	LastReplyAt      *time.Time   `json:"last_reply_at,omitempty" db:"last_reply_at"`
+	SystemEvent      *SystemEvent `json:"system_event,omitempty" db:"system_event"`
+	Seq              int64        `json:"seq" db:"seq"`
+	CreatedAt        time.Time    `json:"created_at" db:"created_at"`
+	EditedAt         *time.Time   `json:"edited_at,omitempty" db:"edited_at"`
+	DeletedAt        *time.Time   `json:"deleted_at,omitempty" db:"deleted_at"`
+
+	// UploadID names an upload to send with a new message; it is only
+	// read by CreateMessage.
+	UploadID  *uuid.UUID        `json:"-" db:"-"`
+	Reactions []ReactionSummary `json:"reactions,omitempty" db:"-"`
+}
+
+var (
+	ErrNotParticipant     = errors.New("user is not a participant of this conversation")
+	ErrInvalidCursor      = errors.New("invalid cursor")
+	ErrMessageNotFound    = errors.New("message not found")
+	ErrNotMessageSender   = errors.New("only the sender can change this message")
+	ErrSystemMessage      = errors.New("system messages cannot be changed")
+	ErrEditWindowExpired  = errors.New("message can no longer be edited")
+	ErrMessageDeleted     = errors.New("message has been deleted")
+	ErrInvalidDeleteScope = errors.New("scope must be me or everyone")
+	ErrMessageTooLong     = errors.New("message is too long")
+)
+
+// MaxMessageRunes is the longest content a message may have.
+const MaxMessageRunes = 4000
+
+// PageDirection selects which side of a cursor a page is read from.
+type PageDirection string
+
+const (
+	PageBefore PageDirection = "before"
+	PageAfter  PageDirection = "after"
+)
+
+// MessageCursor identifies a position in a conversation's timeline. The id
+// breaks ties between messages created in the same microsecond.
+type MessageCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func CursorForMessage(msg *Message) *MessageCursor {
+	return &MessageCursor{CreatedAt: msg.CreatedAt, ID: msg.ID}
+}
+
+// Encode returns the opaque form handed to API clients.
+func (c *MessageCursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeMessageCursor(value string) (*MessageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parsedID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &MessageCursor{CreatedAt: t, ID: parsedID}, nil
 }
 
+// MessageRevision is a previous version of an edited message.
+type MessageRevision struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	MessageID uuid.UUID `json:"message_id" db:"message_id"`
+	Content   string    `json:"content" db:"content"`
+	EditedAt  time.Time `json:"edited_at" db:"edited_at"`
+}
+
+// DeleteScope chooses between hiding a message from yourself and removing
+// it for every participant.
+type DeleteScope string
+
+const (
+	DeleteForMe       DeleteScope = "me"
+	DeleteForEveryone DeleteScope = "everyone"
+)
+
 type MessageStatusType string
 
 const (
@@ -48,57 +146,648 @@ type MessageStatus struct {
 	Timestamp time.Time         `json:"timestamp" db:"timestamp"`
 }
 
+// StatusChange records a recipient's status on a message moving forward,
+// along with the sender who should be told about it.
+type StatusChange struct {
+	MessageID      uuid.UUID         `json:"message_id"`
+	ConversationID uuid.UUID         `json:"conversation_id"`
+	SenderID       uuid.UUID         `json:"-"`
+	UserID         uuid.UUID         `json:"user_id"`
+	Status         MessageStatusType `json:"status"`
+	Timestamp      time.Time         `json:"timestamp"`
+}
+
 type ConversationWithDetails struct {
 	Conversation
 	ParticipantCount int      `json:"participant_count"`
 	LastMessage      *Message `json:"last_message,omitempty"`
 	UnreadCount      int      `json:"unread_count"`
+	// UnreadMentionCount counts the unread messages that mention the user.
+	UnreadMentionCount int `json:"unread_mention_count"`
+	NotificationSettings
 }
 
 type PostgresMessageStore struct {
 	DB *sql.DB
+	// EditWindow is how long after sending a message can still be edited.
+	EditWindow time.Duration
 }
 
-func NewPostgresMessageStore(db *sql.DB) *PostgresMessageStore {
+func NewPostgresMessageStore(db *sql.DB, editWindow time.Duration) *PostgresMessageStore {
 	return &PostgresMessageStore{
-		DB: db,
+		DB:         db,
+		EditWindow: editWindow,
 	}
 }
 
 type MessageStore interface {
 	CreateMessage(ctx context.Context, msg *Message) (*Message, error)
-	GetMessagesByConversationID(ctx context.Context, conversationID uuid.UUID, limit int, before *time.Time) ([]Message, error)
+	GetMessagesByConversationID(ctx context.Context, conversationID uuid.UUID, viewerID uuid.UUID, limit int, cursor *MessageCursor, direction PageDirection) ([]Message, error)
 	CreateMessageStatus(ctx context.Context, messageID uuid.UUID, recipientIDs []uuid.UUID) error
-	UpdateMessageStatus(ctx context.Context, messageID uuid.UUID, userID uuid.UUID, status MessageStatusType) error
+	UpdateMessageStatus(ctx context.Context, messageID uuid.UUID, userID uuid.UUID, status MessageStatusType) (*StatusChange, error)
 	GetUnreadMessagesCount(ctx context.Context, userID uuid.UUID, conversationID uuid.UUID) (int, error)
-	MarkMessagesAsRead(ctx context.Context, userID uuid.UUID, conversationID uuid.UUID) error
-	DeleteMessage(ctx context.Context, messageID uuid.UUID, userID uuid.UUID) error
+	MarkMessagesAsRead(ctx context.Context, userID uuid.UUID, conversationID uuid.UUID) ([]StatusChange, error)
+	DeleteMessage(ctx context.Context, messageID uuid.UUID, userID uuid.UUID, scope DeleteScope) (*Message, error)
+	GetMessageByID(ctx context.Context, messageID uuid.UUID) (*Message, error)
+	GetVisibleMessageByID(ctx context.Context, messageID uuid.UUID, viewerID uuid.UUID) (*Message, error)
+	EditMessage(ctx context.Context, messageID uuid.UUID, editorID uuid.UUID, content string) (*Message, error)
+	GetMessageRevisions(ctx context.Context, messageID uuid.UUID) ([]MessageRevision, error)
+	GetThreadReplies(ctx context.Context, rootID uuid.UUID, viewerID uuid.UUID, limit int, cursor *MessageCursor, direction PageDirection) ([]Message, error)
+	GetThreadUnreadCount(ctx context.Context, rootID uuid.UUID, userID uuid.UUID) (int, error)
+	MarkThreadRead(ctx context.Context, rootID uuid.UUID, userID uuid.UUID) error
+	AddMentions(ctx context.Context, messageID uuid.UUID, mentions []Mention) ([]Mention, error)
+	GetUnreadMentionCount(ctx context.Context, userID uuid.UUID, conversationID uuid.UUID) (int, error)
+	PinMessage(ctx context.Context, conversationID uuid.UUID, messageID uuid.UUID, userID uuid.UUID) (*PinnedMessage, error)
+	UnpinMessage(ctx context.Context, conversationID uuid.UUID, messageID uuid.UUID, userID uuid.UUID) (*Message, error)
+	GetPinnedMessages(ctx context.Context, conversationID uuid.UUID, viewerID uuid.UUID) ([]PinnedMessage, error)
+	SearchMessages(ctx context.Context, userID uuid.UUID, search MessageSearch, limit int, cursor *MessageCursor) ([]SearchResult, error)
+	AddReaction(ctx context.Context, messageID uuid.UUID, userID uuid.UUID, emoji string) (*Message, error)
+	RemoveReaction(ctx context.Context, messageID uuid.UUID, userID uuid.UUID, emoji string) (*Message, error)
 }
 
+// messageColumns is the select list understood by scanMessage. Content and
+// media of deleted messages are never handed back to callers.
+const messageColumns = `
+	m.id, m.conversation_id, m.sender_id,
+	CASE WHEN m.deleted_at IS NULL THEN COALESCE(m.content, '') ELSE '' END,
+	m.message_type,
+	CASE WHEN m.deleted_at IS NULL THEN m.media_url END,
+	CASE WHEN m.deleted_at IS NULL THEN m.media_size END,
+	CASE WHEN m.deleted_at IS NULL THEN m.media_mime_type END,
+	CASE WHEN m.deleted_at IS NULL THEN m.media_width END,
+	CASE WHEN m.deleted_at IS NULL THEN m.media_height END,
+	CASE WHEN m.deleted_at IS NULL THEN m.media_thumbnails END,
+	m.reply_to_message_id, m.thread_root_id, m.reply_count, m.last_reply_at,
+	m.system_event,
+	m.seq, m.created_at, m.edited_at, m.deleted_at
+`
+
+// notHiddenFor filters out messages m that the user bound to param deleted
+// for themselves, and those sent by someone they blocked while the block
+// was in place, which were never delivered to them either.
+func notHiddenFor(param string) string {
+	return `NOT EXISTS (
+		SELECT 1 FROM message_hidden h
+		WHERE h.message_id = m.id AND h.user_id = ` + param + `
+	) AND NOT EXISTS (
+		SELECT 1 FROM user_blocks b
+		WHERE b.blocker_id = ` + param + ` AND b.blocked_id = m.sender_id
+			AND m.created_at >= b.created_at
+	)`
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanMessage reads a row selected with messageColumns. extra receives any
+// columns the caller selected after them.
+func scanMessage(row rowScanner, extra ...any) (*Message, error) {
+	msg := &Message{}
+	dest := []any{
+		&msg.ID,
+		&msg.ConversationID,
+		&msg.SenderID,
+		&msg.Content,
+		&msg.MessageType,
+		&msg.MediaURL,
+		&msg.MediaSize,
+		&msg.MediaMimeType,
+		&msg.MediaWidth,
+		&msg.MediaHeight,
+		&msg.Thumbnails,
+		&msg.ReplyToMessageID,
+		&msg.ThreadRootID,
+		&msg.ReplyCount,
+		&msg.LastReplyAt,
+		&msg.SystemEvent,
+		&msg.Seq,
+		&msg.CreatedAt,
+		&msg.EditedAt,
+		&msg.DeletedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// CreateMessage stores a message from an active participant, attaching the
+// sender's upload when UploadID is set. A message
+// replying to another is filed under the thread of the message it replies
+// to, and that thread's root gets its reply count bumped.
 func (pg *PostgresMessageStore) CreateMessage(ctx context.Context, msg *Message) (*Message, error) {
-	return nil, nil
+	if msg.MessageType == "" {
+		msg.MessageType = MessageTypeText
+	}
+	if utf8.RuneCountInString(msg.Content) > MaxMessageRunes {
+		return nil, ErrMessageTooLong
+	}
+
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := requireParticipant(ctx, tx, msg.ConversationID, msg.SenderID); err != nil {
+		return nil, err
+	}
+	if msg.UploadID != nil {
+		if err := claimUpload(ctx, tx, msg); err != nil {
+			return nil, err
+		}
+	}
+
+	var threadRootID *uuid.UUID
+	if msg.ReplyToMessageID != nil {
+		var parentConversationID, rootID uuid.UUID
+		err := tx.QueryRowContext(ctx, `
+		SELECT conversation_id, COALESCE(thread_root_id, id)
+		FROM messages WHERE id = $1
+		`, *msg.ReplyToMessageID).Scan(&parentConversationID, &rootID)
+		if err == sql.ErrNoRows || (err == nil && parentConversationID != msg.ConversationID) {
+			return nil, ErrMessageNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		threadRootID = &rootID
+	}
+
+	seq, err := nextConversationSeq(ctx, tx, msg.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+	INSERT INTO messages AS m (conversation_id, sender_id, content, message_type,
+		media_url, media_size, media_mime_type, media_width, media_height, media_thumbnails,
+		reply_to_message_id, thread_root_id, seq, change_seq)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $13)
+	RETURNING ` + messageColumns
+	created, err := scanMessage(tx.QueryRowContext(ctx, query,
+		msg.ConversationID,
+		msg.SenderID,
+		msg.Content,
+		msg.MessageType,
+		msg.MediaURL,
+		msg.MediaSize,
+		msg.MediaMimeType,
+		msg.MediaWidth,
+		msg.MediaHeight,
+		msg.Thumbnails,
+		msg.ReplyToMessageID,
+		threadRootID,
+		seq,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.UploadID != nil {
+		_, err = tx.ExecContext(ctx, `UPDATE uploads SET message_id = $2 WHERE id = $1`, *msg.UploadID, created.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if threadRootID != nil {
+		_, err = tx.ExecContext(ctx, `
+		UPDATE messages
+		SET reply_count = reply_count + 1, last_reply_at = $2, change_seq = $3
+		WHERE id = $1
+		`, *threadRootID, created.CreatedAt, seq)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
 }
 
-func (pg *PostgresMessageStore) GetMessagesByConversationID(ctx context.Context, conversationID uuid.UUID, limit int, before *time.Time) ([]Message, error) {
-	return nil, nil
+// GetMessagesByConversationID returns up to limit messages of a
+// conversation's main timeline (thread replies live in their threads) on
+// the given side of cursor, oldest first, leaving out those viewerID deleted
+// for themselves. A nil cursor reads from the newest message (for
+// PageBefore) or the oldest one (for PageAfter).
+func (pg *PostgresMessageStore) GetMessagesByConversationID(ctx context.Context, conversationID uuid.UUID, viewerID uuid.UUID, limit int, cursor *MessageCursor, direction PageDirection) ([]Message, error) {
+	return pg.pageMessages(ctx, "m.conversation_id = $1 AND m.thread_root_id IS NULL", conversationID, viewerID, limit, cursor, direction)
+}
+
+// pageMessages reads one page of the messages matching scope, in which $1 is
+// bound to scopeID.
+func (pg *PostgresMessageStore) pageMessages(ctx context.Context, scope string, scopeID uuid.UUID, viewerID uuid.UUID, limit int, cursor *MessageCursor, direction PageDirection) ([]Message, error) {
+	comparison, order := "<", "DESC"
+	if direction == PageAfter {
+		comparison, order = ">", "ASC"
+	}
+
+	args := []any{scopeID, limit, viewerID}
+	where := scope + " AND " + notHiddenFor("$3")
+	if cursor != nil {
+		where += " AND (m.created_at, m.id) " + comparison + " ($4, $5)"
+		args = append(args, cursor.CreatedAt, cursor.ID)
+	}
+	query := `
+	SELECT ` + messageColumns + `
+	FROM messages m
+	WHERE ` + where + `
+	ORDER BY m.created_at ` + order + `, m.id ` + order + `
+	LIMIT $2
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if direction != PageAfter {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	if err := attachReactions(ctx, pg.DB, messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
 }
 
 func (pg *PostgresMessageStore) CreateMessageStatus(ctx context.Context, messageID uuid.UUID, recipientIDs []uuid.UUID) error {
-	return nil
+	if len(recipientIDs) == 0 {
+		return nil
+	}
+	query := `
+	INSERT INTO message_status (message_id, conversation_id, user_id, status)
+	SELECT m.id, m.conversation_id, r.user_id, 'sent'
+	FROM messages m
+	CROSS JOIN unnest($2::uuid[]) AS r(user_id)
+	WHERE m.id = $1
+	ON CONFLICT (message_id, user_id) DO NOTHING
+	`
+	_, err := pg.DB.ExecContext(ctx, query, messageID, uuidArray(recipientIDs))
+	return err
 }
 
-func (pg *PostgresMessageStore) UpdateMessageStatus(ctx context.Context, messageID uuid.UUID, userID uuid.UUID, status MessageStatusType) error {
-	return nil
+// statusRank orders statuses so updates only ever move a status forward.
+const statusRank = `CASE %s WHEN 'sent' THEN 0 WHEN 'delivered' THEN 1 ELSE 2 END`
+
+var advances = fmt.Sprintf(statusRank, "status") + " < " + fmt.Sprintf(statusRank, "$3::varchar")
+
+// UpdateMessageStatus advances userID's status on messageID. It returns nil
+// without error when the status was already at or past the requested one.
+func (pg *PostgresMessageStore) UpdateMessageStatus(ctx context.Context, messageID uuid.UUID, userID uuid.UUID, status MessageStatusType) (*StatusChange, error) {
+	query := `
+	WITH target AS (
+		SELECT id, conversation_id FROM message_status
+		WHERE message_id = $1 AND user_id = $2
+			AND ` + advances + `
+	), next_seq AS (
+		UPDATE conversations c
+		SET last_seq = c.last_seq + 1
+		FROM target
+		WHERE c.id = target.conversation_id
+		RETURNING c.last_seq
+	)
+	UPDATE message_status ms
+	SET status = $3, timestamp = CURRENT_TIMESTAMP, seq = next_seq.last_seq
+	FROM target, next_seq, messages m
+	WHERE ms.id = target.id AND m.id = ms.message_id
+		AND ` + advances + `
+	RETURNING ms.message_id, m.conversation_id, m.sender_id, ms.user_id, ms.status, ms.timestamp
+	`
+	change := &StatusChange{}
+	err := pg.DB.QueryRowContext(ctx, query, messageID, userID, status).Scan(
+		&change.MessageID,
+		&change.ConversationID,
+		&change.SenderID,
+		&change.UserID,
+		&change.Status,
+		&change.Timestamp,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
 }
 
 func (pg *PostgresMessageStore) GetUnreadMessagesCount(ctx context.Context, userID uuid.UUID, conversationID uuid.UUID) (int, error) {
-	return 0, nil
+	query := `
+	SELECT COUNT(*)
+	FROM message_status ms
+	INNER JOIN messages m ON m.id = ms.message_id
+	WHERE ms.user_id = $1 AND ms.conversation_id = $2 AND ms.status != 'read'
+		AND m.deleted_at IS NULL AND ` + notHiddenFor("$1") + `
+	`
+	var count int
+	err := pg.DB.QueryRowContext(ctx, query, userID, conversationID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
 }
 
-func (pg *PostgresMessageStore) MarkMessagesAsRead(ctx context.Context, userID uuid.UUID, conversationID uuid.UUID) error {
-	return nil
+func (pg *PostgresMessageStore) MarkMessagesAsRead(ctx context.Context, userID uuid.UUID, conversationID uuid.UUID) ([]StatusChange, error) {
+	query := `
+	WITH next_seq AS (
+		UPDATE conversations
+		SET last_seq = last_seq + 1
+		WHERE id = $2 AND EXISTS (
+			SELECT 1 FROM message_status
+			WHERE user_id = $1 AND conversation_id = $2 AND status != 'read'
+		)
+		RETURNING last_seq
+	)
+	UPDATE message_status ms
+	SET status = 'read', timestamp = CURRENT_TIMESTAMP, seq = next_seq.last_seq
+	FROM next_seq, messages m
+	WHERE m.id = ms.message_id
+		AND ms.user_id = $1 AND ms.conversation_id = $2 AND ms.status != 'read'
+	RETURNING ms.message_id, m.conversation_id, m.sender_id, ms.user_id, ms.status, ms.timestamp
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []StatusChange
+	for rows.Next() {
+		var change StatusChange
+		err := rows.Scan(
+			&change.MessageID,
+			&change.ConversationID,
+			&change.SenderID,
+			&change.UserID,
+			&change.Status,
+			&change.Timestamp,
+		)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// DeleteMessage hides a message from userID (DeleteForMe) or, for its
+// sender, scrubs its content, media and edit history for everyone
+// (DeleteForEveryone). The message row stays as a tombstone so the
+// conversation keeps its shape.
+func (pg *PostgresMessageStore) DeleteMessage(ctx context.Context, messageID uuid.UUID, userID uuid.UUID, scope DeleteScope) (*Message, error) {
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	SELECT m.conversation_id, m.sender_id, m.message_type, m.deleted_at
+	FROM messages m
+	WHERE m.id = $1
+	FOR UPDATE
+	`
+	var (
+		conversationID uuid.UUID
+		senderID       uuid.UUID
+		messageType    MessageType
+		deletedAt      *time.Time
+	)
+	err = tx.QueryRowContext(ctx, query, messageID).Scan(&conversationID, &senderID, &messageType, &deletedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := requireParticipant(ctx, tx, conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	var msg *Message
+	switch scope {
+	case DeleteForMe:
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO message_hidden (message_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+		`, messageID, userID)
+		if err != nil {
+			return nil, err
+		}
+		msg, err = scanMessage(tx.QueryRowContext(ctx, `SELECT `+messageColumns+` FROM messages m WHERE m.id = $1`, messageID))
+		if err != nil {
+			return nil, err
+		}
+	case DeleteForEveryone:
+		if messageType == MessageTypeSystem {
+			return nil, ErrSystemMessage
+		}
+		if senderID != userID {
+			return nil, ErrNotMessageSender
+		}
+		if deletedAt != nil {
+			return nil, ErrMessageDeleted
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM message_revisions WHERE message_id = $1`, messageID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM message_reactions WHERE message_id = $1`, messageID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM pinned_messages WHERE message_id = $1`, messageID); err != nil {
+			return nil, err
+		}
+		if err := deleteMessageUpload(ctx, tx, messageID); err != nil {
+			return nil, err
+		}
+		seq, err := nextConversationSeq(ctx, tx, conversationID)
+		if err != nil {
+			return nil, err
+		}
+		updateQuery := `
+		UPDATE messages AS m
+		SET deleted_at = CURRENT_TIMESTAMP, content = NULL, media_url = NULL,
+			media_size = NULL, media_mime_type = NULL, media_width = NULL,
+			media_height = NULL, media_thumbnails = NULL, change_seq = $2
+		WHERE m.id = $1
+		RETURNING ` + messageColumns
+		msg, err = scanMessage(tx.QueryRowContext(ctx, updateQuery, messageID, seq))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrInvalidDeleteScope
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (pg *PostgresMessageStore) GetMessageByID(ctx context.Context, messageID uuid.UUID) (*Message, error) {
+	return pg.getMessage(ctx, `m.id = $1`, messageID)
+}
+
+// GetVisibleMessageByID is GetMessageByID for reads on behalf of viewerID:
+// messages hidden from the viewer are reported as not found, as they are
+// left out of every list the viewer sees.
+func (pg *PostgresMessageStore) GetVisibleMessageByID(ctx context.Context, messageID uuid.UUID, viewerID uuid.UUID) (*Message, error) {
+	return pg.getMessage(ctx, `m.id = $1 AND `+notHiddenFor("$2"), messageID, viewerID)
 }
 
-func (pg *PostgresMessageStore) DeleteMessage(ctx context.Context, messageID uuid.UUID, userID uuid.UUID) error {
+func (pg *PostgresMessageStore) getMessage(ctx context.Context, where string, args ...any) (*Message, error) {
+	query := `SELECT ` + messageColumns + ` FROM messages m WHERE ` + where
+	msg, err := scanMessage(pg.DB.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	messages := []Message{*msg}
+	if err := attachReactions(ctx, pg.DB, messages); err != nil {
+		return nil, err
+	}
+	return &messages[0], nil
+}
+
+// EditMessage replaces the content of a message, keeping the previous
+// version in message_revisions. Only the sender may edit, and only within
+// the store's edit window.
+func (pg *PostgresMessageStore) EditMessage(ctx context.Context, messageID uuid.UUID, editorID uuid.UUID, content string) (*Message, error) {
+	if utf8.RuneCountInString(content) > MaxMessageRunes {
+		return nil, ErrMessageTooLong
+	}
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	SELECT m.conversation_id, m.sender_id, m.message_type, COALESCE(m.content, ''), m.created_at, m.deleted_at
+	FROM messages m
+	WHERE m.id = $1
+	FOR UPDATE
+	`
+	var (
+		conversationID uuid.UUID
+		senderID       uuid.UUID
+		messageType    MessageType
+		oldContent     string
+		createdAt      time.Time
+		deletedAt      *time.Time
+	)
+	err = tx.QueryRowContext(ctx, query, messageID).Scan(&conversationID, &senderID, &messageType, &oldContent, &createdAt, &deletedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if messageType == MessageTypeSystem {
+		return nil, ErrSystemMessage
+	}
+	if senderID != editorID {
+		return nil, ErrNotMessageSender
+	}
+	if deletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+	if time.Since(createdAt) > pg.EditWindow {
+		return nil, ErrEditWindowExpired
+	}
+	if err := requireParticipant(ctx, tx, conversationID, editorID); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO message_revisions (message_id, content)
+	VALUES ($1, $2)
+	`, messageID, oldContent)
+	if err != nil {
+		return nil, err
+	}
+
+	seq, err := nextConversationSeq(ctx, tx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	updateQuery := `
+	UPDATE messages AS m
+	SET content = $2, edited_at = CURRENT_TIMESTAMP, change_seq = $3
+	WHERE m.id = $1
+	RETURNING ` + messageColumns
+	msg, err := scanMessage(tx.QueryRowContext(ctx, updateQuery, messageID, content, seq))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (pg *PostgresMessageStore) GetMessageRevisions(ctx context.Context, messageID uuid.UUID) ([]MessageRevision, error) {
+	query := `
+	SELECT id, message_id, COALESCE(content, ''), edited_at
+	FROM message_revisions
+	WHERE message_id = $1
+	ORDER BY edited_at
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []MessageRevision{}
+	for rows.Next() {
+		var revision MessageRevision
+		if err := rows.Scan(&revision.ID, &revision.MessageID, &revision.Content, &revision.EditedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// requireParticipant returns ErrNotParticipant unless userID is an active
+// member of the conversation.
+func requireParticipant(ctx context.Context, tx *sql.Tx, conversationID uuid.UUID, userID uuid.UUID) error {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM conversation_participants
+		WHERE conversation_id = $1 AND user_id = $2 AND left_at IS NULL
+	)
+	`
+	var ok bool
+	if err := tx.QueryRowContext(ctx, query, conversationID, userID).Scan(&ok); err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotParticipant
+	}
 	return nil
 }
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	NotifyAll      = "all"
+	NotifyMentions = "mentions"
+	NotifyNone     = "none"
+)
+
+var ErrInvalidNotificationLevel = errors.New("notification_level must be all, mentions or none")
+
+// NotificationSettings are a participant's preferences for being notified
+// about a conversation. They never affect unread counts.
+type NotificationSettings struct {
+	Level      string     `json:"notification_level" db:"notification_level"`
+	MutedUntil *time.Time `json:"muted_until,omitempty" db:"muted_until"`
+}
+
+// Notifies reports whether a message, mentioning the participant or not,
+// should notify them at now.
+func (s NotificationSettings) Notifies(mentioned bool, now time.Time) bool {
+	if s.MutedUntil != nil && s.MutedUntil.After(now) {
+		return false
+	}
+	switch s.Level {
+	case NotifyNone:
+		return false
+	case NotifyMentions:
+		return mentioned
+	default:
+		return true
+	}
+}
+
+func (pg *PostgresConversationStore) GetNotificationSettings(ctx context.Context, conversationID uuid.UUID, userID uuid.UUID) (*NotificationSettings, error) {
+	query := `
+	SELECT notification_level, muted_until
+	FROM conversation_participants
+	WHERE conversation_id = $1 AND user_id = $2 AND left_at IS NULL
+	`
+	settings := &NotificationSettings{}
+	err := pg.DB.QueryRowContext(ctx, query, conversationID, userID).Scan(&settings.Level, &settings.MutedUntil)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotParticipant
+	}
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// UpdateNotificationSettings replaces userID's settings for a
+// conversation. A nil MutedUntil unmutes it.
+func (pg *PostgresConversationStore) UpdateNotificationSettings(ctx context.Context, conversationID uuid.UUID, userID uuid.UUID, settings NotificationSettings) (*NotificationSettings, error) {
+	if settings.Level != NotifyAll && settings.Level != NotifyMentions && settings.Level != NotifyNone {
+		return nil, ErrInvalidNotificationLevel
+	}
+	query := `
+	UPDATE conversation_participants
+	SET notification_level = $3, muted_until = $4
+	WHERE conversation_id = $1 AND user_id = $2 AND left_at IS NULL
+	RETURNING notification_level, muted_until
+	`
+	updated := &NotificationSettings{}
+	err := pg.DB.QueryRowContext(ctx, query, conversationID, userID, settings.Level, settings.MutedUntil).Scan(&updated.Level, &updated.MutedUntil)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotParticipant
+	}
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// GetParticipantNotificationSettings returns the settings of those of
+// userIDs who are active participants of the conversation.
+func (pg *PostgresConversationStore) GetParticipantNotificationSettings(ctx context.Context, conversationID uuid.UUID, userIDs []uuid.UUID) (map[uuid.UUID]NotificationSettings, error) {
+	query := `
+	SELECT user_id, notification_level, muted_until
+	FROM conversation_participants
+	WHERE conversation_id = $1 AND user_id = ANY($2::uuid[]) AND left_at IS NULL
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, conversationID, uuidArray(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[uuid.UUID]NotificationSettings, len(userIDs))
+	for rows.Next() {
+		var (
+			userID uuid.UUID
+			s      NotificationSettings
+		)
+		if err := rows.Scan(&userID, &s.Level, &s.MutedUntil); err != nil {
+			return nil, err
+		}
+		settings[userID] = s
+	}
+	return settings, rows.Err()
+}
@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxPinnedMessages is how many messages a conversation can have pinned at
+// once.
+const MaxPinnedMessages = 50
+
+var (
+	ErrNotAdmin      = errors.New("only group admins can do this")
+	ErrTooManyPins   = errors.New("this conversation has too many pinned messages")
+	ErrNotPinned     = errors.New("message is not pinned")
+	ErrAlreadyPinned = errors.New("message is already pinned")
+)
+
+type PinnedMessage struct {
+	Message  Message    `json:"message"`
+	PinnedBy *uuid.UUID `json:"pinned_by,omitempty"`
+	PinnedAt time.Time  `json:"pinned_at"`
+}
+
+// PinMessage pins a message of a conversation userID may manage pins of:
+// as an admin of a group, or as either party of a direct conversation.
+func (pg *PostgresMessageStore) PinMessage(ctx context.Context, conversationID uuid.UUID, messageID uuid.UUID, userID uuid.UUID) (*PinnedMessage, error) {
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	msg, err := lockPinnableMessage(ctx, tx, conversationID, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.DeletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, `
+	SELECT COUNT(*) FROM pinned_messages WHERE conversation_id = $1
+	`, msg.ConversationID).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	if count >= MaxPinnedMessages {
+		return nil, ErrTooManyPins
+	}
+
+	pin := &PinnedMessage{Message: *msg}
+	err = tx.QueryRowContext(ctx, `
+	INSERT INTO pinned_messages (message_id, conversation_id, pinned_by)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (message_id) DO NOTHING
+	RETURNING pinned_by, pinned_at
+	`, messageID, msg.ConversationID, userID).Scan(&pin.PinnedBy, &pin.PinnedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrAlreadyPinned
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return pin, nil
+}
+
+// UnpinMessage unpins a message, with the same rights as PinMessage.
+func (pg *PostgresMessageStore) UnpinMessage(ctx context.Context, conversationID uuid.UUID, messageID uuid.UUID, userID uuid.UUID) (*Message, error) {
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	msg, err := lockPinnableMessage(ctx, tx, conversationID, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM pinned_messages WHERE message_id = $1`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrNotPinned
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// GetPinnedMessages lists a conversation's pins, most recently pinned
+// first, leaving out messages viewerID deleted for themselves.
+func (pg *PostgresMessageStore) GetPinnedMessages(ctx context.Context, conversationID uuid.UUID, viewerID uuid.UUID) ([]PinnedMessage, error) {
+	query := `
+	SELECT ` + messageColumns + `, p.pinned_by, p.pinned_at
+	FROM pinned_messages p
+	INNER JOIN messages m ON m.id = p.message_id
+	WHERE p.conversation_id = $1 AND ` + notHiddenFor("$2") + `
+	ORDER BY p.pinned_at DESC
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, conversationID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pins := []PinnedMessage{}
+	for rows.Next() {
+		var pin PinnedMessage
+		msg, err := scanMessage(rows, &pin.PinnedBy, &pin.PinnedAt)
+		if err != nil {
+			return nil, err
+		}
+		pin.Message = *msg
+		pins = append(pins, pin)
+	}
+	return pins, rows.Err()
+}
+
+// lockPinnableMessage loads a message of a conversation after checking
+// userID may manage the conversation's pins. The conversation row is
+// locked so concurrent pins can't exceed MaxPinnedMessages.
+func lockPinnableMessage(ctx context.Context, tx *sql.Tx, conversationID uuid.UUID, messageID uuid.UUID, userID uuid.UUID) (*Message, error) {
+	msg, err := scanMessage(tx.QueryRowContext(ctx, `
+	SELECT `+messageColumns+`
+	FROM messages m
+	WHERE m.id = $1 AND m.conversation_id = $2
+	`, messageID, conversationID))
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		conversationType ConversationType
+		role             string
+	)
+	err = tx.QueryRowContext(ctx, `
+	SELECT c.type, cp.role
+	FROM conversations c
+	INNER JOIN conversation_participants cp
+		ON cp.conversation_id = c.id AND cp.user_id = $2 AND cp.left_at IS NULL
+	WHERE c.id = $1
+	FOR UPDATE OF c
+	`, msg.ConversationID, userID).Scan(&conversationType, &role)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotParticipant
+	}
+	if err != nil {
+		return nil, err
+	}
+	if conversationType == ConversationTypeGroup && role != ParticipantRoleAdmin {
+		return nil, ErrNotAdmin
+	}
+	return msg, nil
+}
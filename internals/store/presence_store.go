@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PostgresPresenceStore struct {
+	DB *sql.DB
+}
+
+func NewPostgresPresenceStore(db *sql.DB) *PostgresPresenceStore {
+	return &PostgresPresenceStore{
+		DB: db,
+	}
+}
+
+// PresenceStore shares who is connected between server instances. Each
+// instance reports the status of the users connected to it; a user's
+// presence is the best status any live instance reports.
+type PresenceStore interface {
+	SetInstancePresence(ctx context.Context, instanceID uuid.UUID, userID uuid.UUID, status string) error
+	SyncInstancePresence(ctx context.Context, instanceID uuid.UUID, statuses map[uuid.UUID]string, staleAfter time.Duration) error
+	GetPresence(ctx context.Context, userIDs []uuid.UUID, staleAfter time.Duration) (map[uuid.UUID]string, error)
+}
+
+// SetInstancePresence records userID's status on instanceID. An empty
+// status means the user has no connection left there.
+func (pg *PostgresPresenceStore) SetInstancePresence(ctx context.Context, instanceID uuid.UUID, userID uuid.UUID, status string) error {
+	if status == "" {
+		_, err := pg.DB.ExecContext(ctx, `
+		DELETE FROM user_presence WHERE instance_id = $1 AND user_id = $2
+		`, instanceID, userID)
+		return err
+	}
+	query := `
+	INSERT INTO user_presence (instance_id, user_id, status)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (instance_id, user_id) DO UPDATE
+	SET status = EXCLUDED.status, updated_at = CURRENT_TIMESTAMP
+	`
+	_, err := pg.DB.ExecContext(ctx, query, instanceID, userID, status)
+	return err
+}
+
+// SyncInstancePresence replaces everything recorded for instanceID with
+// statuses and marks it fresh. It doubles as the instance's heartbeat, and
+// also removes rows no instance has refreshed within staleAfter. Callers
+// must not run it concurrently with SetInstancePresence for the same
+// instance, or an older snapshot may win.
+func (pg *PostgresPresenceStore) SyncInstancePresence(ctx context.Context, instanceID uuid.UUID, statuses map[uuid.UUID]string, staleAfter time.Duration) error {
+	userIDs := make([]uuid.UUID, 0, len(statuses))
+	values := make([]string, 0, len(statuses))
+	for userID, status := range statuses {
+		userIDs = append(userIDs, userID)
+		values = append(values, status)
+	}
+
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+	DELETE FROM user_presence
+	WHERE (instance_id = $1 AND user_id != ALL($2::uuid[]))
+		OR updated_at < CURRENT_TIMESTAMP - $3 * INTERVAL '1 second'
+	`, instanceID, uuidArray(userIDs), staleAfter.Seconds())
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO user_presence (instance_id, user_id, status)
+	SELECT $1, x.user_id, x.status
+	FROM unnest($2::uuid[], $3::text[]) AS x(user_id, status)
+	INNER JOIN users u ON u.id = x.user_id
+	ON CONFLICT (instance_id, user_id) DO UPDATE
+	SET status = EXCLUDED.status, updated_at = CURRENT_TIMESTAMP
+	`, instanceID, uuidArray(userIDs), values)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetPresence returns the status of those of userIDs connected to at least
+// one instance heard from within staleAfter: online if any instance says
+// so, away otherwise. Offline users are left out.
+func (pg *PostgresPresenceStore) GetPresence(ctx context.Context, userIDs []uuid.UUID, staleAfter time.Duration) (map[uuid.UUID]string, error) {
+	statuses := make(map[uuid.UUID]string)
+	if len(userIDs) == 0 {
+		return statuses, nil
+	}
+	query := `
+	SELECT user_id, CASE WHEN bool_or(status = 'online') THEN 'online' ELSE 'away' END
+	FROM user_presence
+	WHERE user_id = ANY($1::uuid[])
+		AND updated_at >= CURRENT_TIMESTAMP - $2 * INTERVAL '1 second'
+	GROUP BY user_id
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, uuidArray(userIDs), staleAfter.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID uuid.UUID
+		var status string
+		if err := rows.Scan(&userID, &status); err != nil {
+			return nil, err
+		}
+		statuses[userID] = status
+	}
+	return statuses, rows.Err()
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrPushSubscriptionNotFound = errors.New("push subscription not found")
+
+type PushSubscription struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	Endpoint  string    `json:"endpoint" db:"endpoint"`
+	P256dh    string    `json:"-" db:"p256dh"`
+	Auth      string    `json:"-" db:"auth"`
+	UserAgent *string   `json:"user_agent,omitempty" db:"user_agent"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type PostgresPushStore struct {
+	DB *sql.DB
+}
+
+func NewPostgresPushStore(db *sql.DB) *PostgresPushStore {
+	return &PostgresPushStore{
+		DB: db,
+	}
+}
+
+type PushStore interface {
+	SavePushSubscription(ctx context.Context, sub *PushSubscription) (*PushSubscription, error)
+	GetPushSubscriptions(ctx context.Context, userIDs []uuid.UUID) ([]PushSubscription, error)
+	DeletePushSubscription(ctx context.Context, id uuid.UUID, userID uuid.UUID) error
+	DeletePushSubscriptionByEndpoint(ctx context.Context, endpoint string) error
+}
+
+const pushSubscriptionColumns = `id, user_id, endpoint, p256dh, auth, user_agent, created_at`
+
+func scanPushSubscription(row rowScanner) (*PushSubscription, error) {
+	sub := &PushSubscription{}
+	err := row.Scan(&sub.ID, &sub.UserID, &sub.Endpoint, &sub.P256dh, &sub.Auth, &sub.UserAgent, &sub.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// SavePushSubscription registers sub for sub.UserID. An endpoint that is
+// already registered takes the new keys and owner.
+func (pg *PostgresPushStore) SavePushSubscription(ctx context.Context, sub *PushSubscription) (*PushSubscription, error) {
+	query := `
+	INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth, user_agent)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (endpoint) DO UPDATE
+	SET user_id = EXCLUDED.user_id, p256dh = EXCLUDED.p256dh, auth = EXCLUDED.auth,
+		user_agent = EXCLUDED.user_agent
+	RETURNING ` + pushSubscriptionColumns
+	return scanPushSubscription(pg.DB.QueryRowContext(ctx, query, sub.UserID, sub.Endpoint, sub.P256dh, sub.Auth, sub.UserAgent))
+}
+
+// GetPushSubscriptions returns the subscriptions of every user in userIDs.
+func (pg *PostgresPushStore) GetPushSubscriptions(ctx context.Context, userIDs []uuid.UUID) ([]PushSubscription, error) {
+	query := `
+	SELECT ` + pushSubscriptionColumns + `
+	FROM push_subscriptions
+	WHERE user_id = ANY($1::uuid[])
+	ORDER BY created_at
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, uuidArray(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []PushSubscription{}
+	for rows.Next() {
+		sub, err := scanPushSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, *sub)
+	}
+	return subs, rows.Err()
+}
+
+func (pg *PostgresPushStore) DeletePushSubscription(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	result, err := pg.DB.ExecContext(ctx, `DELETE FROM push_subscriptions WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrPushSubscriptionNotFound
+	}
+	return nil
+}
+
+// DeletePushSubscriptionByEndpoint forgets a subscription its push service
+// reported gone.
+func (pg *PostgresPushStore) DeletePushSubscriptionByEndpoint(ctx context.Context, endpoint string) error {
+	_, err := pg.DB.ExecContext(ctx, `DELETE FROM push_subscriptions WHERE endpoint = $1`, endpoint)
+	return err
+}
@@ -0,0 +1,192 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidReaction = errors.New("reaction must be a single emoji")
+
+// maxReactionRunes leaves room for skin tones and ZWJ sequences such as
+// family emoji while rejecting arbitrary text.
+const maxReactionRunes = 10
+
+// ReactionSummary aggregates one emoji on one message.
+type ReactionSummary struct {
+	Emoji   string      `json:"emoji"`
+	Count   int         `json:"count"`
+	UserIDs []uuid.UUID `json:"user_ids"`
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// validReaction accepts short strings without spaces or control characters
+// that contain at least one emoji symbol, a keycap or an emoji presentation
+// selector. Emoji built on letters and digits such as 1️⃣ or ℹ️ qualify by
+// their combining marks.
+func validReaction(emoji string) bool {
+	if emoji == "" || len(emoji) > 32 || !utf8.ValidString(emoji) {
+		return false
+	}
+	if utf8.RuneCountInString(emoji) > maxReactionRunes {
+		return false
+	}
+	if strings.ContainsFunc(emoji, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}) {
+		return false
+	}
+	return strings.ContainsFunc(emoji, func(r rune) bool {
+		return unicode.IsSymbol(r) || r == emojiPresentation || r == combiningKeycap
+	})
+}
+
+const (
+	emojiPresentation = '\uFE0F'
+	combiningKeycap   = '\u20E3'
+)
+
+// AddReaction records userID reacting to a message with emoji and returns
+// the message with its updated reactions. Reacting twice with the same
+// emoji is a no-op.
+func (pg *PostgresMessageStore) AddReaction(ctx context.Context, messageID uuid.UUID, userID uuid.UUID, emoji string) (*Message, error) {
+	if !validReaction(emoji) {
+		return nil, ErrInvalidReaction
+	}
+	return pg.changeReaction(ctx, messageID, userID, `
+	INSERT INTO message_reactions (message_id, user_id, emoji)
+	VALUES ($1, $2, $3)
+	ON CONFLICT DO NOTHING
+	`, emoji)
+}
+
+// RemoveReaction takes back userID's emoji reaction on a message.
+func (pg *PostgresMessageStore) RemoveReaction(ctx context.Context, messageID uuid.UUID, userID uuid.UUID, emoji string) (*Message, error) {
+	return pg.changeReaction(ctx, messageID, userID, `
+	DELETE FROM message_reactions
+	WHERE message_id = $1 AND user_id = $2 AND emoji = $3
+	`, emoji)
+}
+
+func (pg *PostgresMessageStore) changeReaction(ctx context.Context, messageID uuid.UUID, userID uuid.UUID, statement string, emoji string) (*Message, error) {
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		conversationID uuid.UUID
+		deletedAt      *time.Time
+	)
+	err = tx.QueryRowContext(ctx, `
+	SELECT conversation_id, deleted_at FROM messages WHERE id = $1 FOR UPDATE
+	`, messageID).Scan(&conversationID, &deletedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deletedAt != nil {
+		return nil, ErrMessageDeleted
+	}
+	if err := requireParticipant(ctx, tx, conversationID, userID); err != nil {
+		return nil, err
+	}
+
+	result, err := tx.ExecContext(ctx, statement, messageID, userID, emoji)
+	if err != nil {
+		return nil, err
+	}
+	if changed, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if changed > 0 {
+		// Reactions are part of the message as far as sync is concerned.
+		seq, err := nextConversationSeq(ctx, tx, conversationID)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE messages SET change_seq = $2 WHERE id = $1`, messageID, seq)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	msg, err := scanMessage(tx.QueryRowContext(ctx, `SELECT `+messageColumns+` FROM messages m WHERE m.id = $1`, messageID))
+	if err != nil {
+		return nil, err
+	}
+	messages := []Message{*msg}
+	if err := attachReactions(ctx, tx, messages); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &messages[0], nil
+}
+
+// attachReactions fills in the Reactions of each message, emoji in the
+// order they were first used.
+func attachReactions(ctx context.Context, q queryer, messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(messages))
+	index := make(map[uuid.UUID]int, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+		index[messages[i].ID] = i
+	}
+
+	query := `
+	SELECT message_id, emoji, user_id
+	FROM message_reactions
+	WHERE message_id = ANY($1::uuid[])
+	ORDER BY message_id, created_at
+	`
+	rows, err := q.QueryContext(ctx, query, uuidArray(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			messageID uuid.UUID
+			emoji     string
+			userID    uuid.UUID
+		)
+		if err := rows.Scan(&messageID, &emoji, &userID); err != nil {
+			return err
+		}
+		msg := &messages[index[messageID]]
+		found := false
+		for i := range msg.Reactions {
+			if msg.Reactions[i].Emoji == emoji {
+				msg.Reactions[i].Count++
+				msg.Reactions[i].UserIDs = append(msg.Reactions[i].UserIDs, userID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			msg.Reactions = append(msg.Reactions, ReactionSummary{
+				Emoji:   emoji,
+				Count:   1,
+				UserIDs: []uuid.UUID{userID},
+			})
+		}
+	}
+	return rows.Err()
+}
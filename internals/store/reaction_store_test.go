@@ -0,0 +1,38 @@
+package store
+
+import "testing"
+
+func TestValidReaction(t *testing.T) {
+	for _, emoji := range []string{
+		"👍",
+		"👍🏽",
+		"👨‍👩‍👧‍👦",
+		"🇫🇷",
+		"❤️",
+		"1️⃣",
+		"9️⃣",
+		"#️⃣",
+		"ℹ️",
+		"™️",
+		"©",
+	} {
+		if !validReaction(emoji) {
+			t.Errorf("validReaction(%q) = false, want true", emoji)
+		}
+	}
+	for _, emoji := range []string{
+		"",
+		"a",
+		"lol",
+		"1",
+		"👍 👍",
+		"👍\n",
+		"\x00👍",
+		"👍👍👍👍👍👍👍👍👍👍👍",
+		"\xff",
+	} {
+		if validReaction(emoji) {
+			t.Errorf("validReaction(%q) = true, want false", emoji)
+		}
+	}
+}
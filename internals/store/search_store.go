@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MessageSearch describes a search over the messages a user can see. Every
+// field set narrows the results; Query uses web search syntax ("quoted
+// phrases", or, -excluded).
+type MessageSearch struct {
+	Query          string
+	ConversationID *uuid.UUID
+	SenderID       *uuid.UUID
+	Since          *time.Time
+	Until          *time.Time
+	HasAttachment  bool
+}
+
+// SearchResult is a matching message with the matched words of its content
+// wrapped in <mark> tags. The rest of the snippet is HTML-escaped, so it can
+// be rendered as HTML as is.
+type SearchResult struct {
+	Message
+	Snippet string `json:"snippet"`
+}
+
+// escapedContent is message content HTML-escaped inside Postgres, so only
+// the <mark> tags ts_headline adds are markup.
+const escapedContent = `replace(replace(replace(COALESCE(m.content, ''), '&', '&amp;'), '<', '&lt;'), '>', '&gt;')`
+
+// SearchMessages returns up to limit messages matching search in
+// conversations userID is an active participant of, newest first and older
+// than cursor when it is set. Messages deleted for everyone or hidden by
+// the user never match.
+func (pg *PostgresMessageStore) SearchMessages(ctx context.Context, userID uuid.UUID, search MessageSearch, limit int, cursor *MessageCursor) ([]SearchResult, error) {
+	args := []any{userID, limit}
+	param := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conditions := []string{
+		"m.deleted_at IS NULL",
+		notHiddenFor("$1"),
+	}
+	snippet := "''"
+	if search.Query != "" {
+		query := "websearch_to_tsquery('simple', " + param(search.Query) + ")"
+		conditions = append(conditions, "m.content_tsv @@ "+query)
+		snippet = "ts_headline('simple', " + escapedContent + ", " + query +
+			", 'StartSel=<mark>, StopSel=</mark>, MaxWords=30, MinWords=10, MaxFragments=2')"
+	}
+	if search.ConversationID != nil {
+		conditions = append(conditions, "m.conversation_id = "+param(*search.ConversationID))
+	}
+	if search.SenderID != nil {
+		conditions = append(conditions, "m.sender_id = "+param(*search.SenderID))
+	}
+	if search.Since != nil {
+		conditions = append(conditions, "m.created_at >= "+param(*search.Since))
+	}
+	if search.Until != nil {
+		conditions = append(conditions, "m.created_at < "+param(*search.Until))
+	}
+	if search.HasAttachment {
+		conditions = append(conditions, "m.media_url IS NOT NULL")
+	}
+	if cursor != nil {
+		conditions = append(conditions, "(m.created_at, m.id) < ("+param(cursor.CreatedAt)+", "+param(cursor.ID)+")")
+	}
+
+	query := `
+	SELECT ` + messageColumns + `, ` + snippet + `
+	FROM messages m
+	JOIN conversation_participants cp
+		ON cp.conversation_id = m.conversation_id
+		AND cp.user_id = $1 AND cp.left_at IS NULL
+	WHERE ` + strings.Join(conditions, " AND ") + `
+	ORDER BY m.created_at DESC, m.id DESC
+	LIMIT $2
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var snippet string
+		msg, err := scanMessage(rows, &snippet)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, SearchResult{Message: *msg, Snippet: snippet})
+	}
+	return results, rows.Err()
+}
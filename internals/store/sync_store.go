@@ -0,0 +1,243 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// SyncCursor maps each conversation to the last change number a client has
+// seen in it.
+type SyncCursor map[uuid.UUID]int64
+
+// Encode returns the opaque form handed to API clients.
+func (c SyncCursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func DecodeSyncCursor(value string) (SyncCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	cursor := SyncCursor{}
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// SyncResult holds every change in a user's conversations between two
+// cursors. Messages carry their current state, so an edited or deleted
+// message shows up again with its new content.
+type SyncResult struct {
+	Messages    []Message                 `json:"messages"`
+	Statuses    []StatusChange            `json:"statuses"`
+	Memberships []ConversationParticipant `json:"memberships"`
+	Cursor      string                    `json:"cursor"`
+	HasMore     bool                      `json:"has_more"`
+}
+
+type PostgresSyncStore struct {
+	DB *sql.DB
+}
+
+func NewPostgresSyncStore(db *sql.DB) *PostgresSyncStore {
+	return &PostgresSyncStore{
+		DB: db,
+	}
+}
+
+type SyncStore interface {
+	GetChangesSince(ctx context.Context, userID uuid.UUID, since SyncCursor, limit int) (*SyncResult, error)
+}
+
+type syncRange struct {
+	conversationID uuid.UUID
+	from           int64
+	to             int64
+}
+
+// GetChangesSince returns changes after since, reading at most limit
+// messages. A nil since returns no changes, only a cursor for the current
+// state. Conversations missing from since are synced from the beginning.
+func (pg *PostgresSyncStore) GetChangesSince(ctx context.Context, userID uuid.UUID, since SyncCursor, limit int) (*SyncResult, error) {
+	// A user who left a conversation only sees changes up to their leaving,
+	// which is recorded in their own participant row's seq.
+	query := `
+	SELECT p.conversation_id,
+		CASE WHEN p.left_at IS NULL THEN c.last_seq ELSE p.seq END
+	FROM conversation_participants p
+	INNER JOIN conversations c ON c.id = p.conversation_id
+	WHERE p.user_id = $1
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	var ranges []syncRange
+	for rows.Next() {
+		var r syncRange
+		if err := rows.Scan(&r.conversationID, &r.to); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		r.from = since[r.conversationID]
+		ranges = append(ranges, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{
+		Messages:    []Message{},
+		Statuses:    []StatusChange{},
+		Memberships: []ConversationParticipant{},
+	}
+	next := SyncCursor{}
+	for _, r := range ranges {
+		if since == nil || r.from >= r.to {
+			next[r.conversationID] = r.to
+			continue
+		}
+		if limit <= 0 {
+			next[r.conversationID] = r.from
+			result.HasMore = true
+			continue
+		}
+
+		messages, err := pg.changedMessages(ctx, r, userID, limit+1)
+		if err != nil {
+			return nil, err
+		}
+		if len(messages) > limit {
+			// Stop this conversation at the last message returned; the
+			// rest is picked up by the next sync.
+			messages = messages[:limit]
+			r.to = messages[len(messages)-1].changeSeq
+			result.HasMore = true
+		}
+		limit -= len(messages)
+		page := make([]Message, len(messages))
+		for i, m := range messages {
+			page[i] = m.Message
+		}
+		if err := attachReactions(ctx, pg.DB, page); err != nil {
+			return nil, err
+		}
+		result.Messages = append(result.Messages, page...)
+
+		statuses, err := pg.changedStatuses(ctx, r, userID)
+		if err != nil {
+			return nil, err
+		}
+		result.Statuses = append(result.Statuses, statuses...)
+
+		memberships, err := pg.changedMemberships(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		result.Memberships = append(result.Memberships, memberships...)
+
+		next[r.conversationID] = r.to
+	}
+	result.Cursor = next.Encode()
+	return result, nil
+}
+
+type changedMessage struct {
+	Message
+	changeSeq int64
+}
+
+func (pg *PostgresSyncStore) changedMessages(ctx context.Context, r syncRange, userID uuid.UUID, limit int) ([]changedMessage, error) {
+	query := `
+	SELECT ` + messageColumns + `, m.change_seq
+	FROM messages m
+	WHERE m.conversation_id = $1 AND m.change_seq > $2 AND m.change_seq <= $3
+		AND ` + notHiddenFor("$5") + `
+	ORDER BY m.change_seq
+	LIMIT $4
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, r.conversationID, r.from, r.to, limit, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []changedMessage
+	for rows.Next() {
+		var changeSeq int64
+		msg, err := scanMessage(rows, &changeSeq)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, changedMessage{Message: *msg, changeSeq: changeSeq})
+	}
+	return messages, rows.Err()
+}
+
+// changedStatuses returns receipts the user cares about: those on messages
+// they sent, and their own (so their other devices agree on what is read).
+func (pg *PostgresSyncStore) changedStatuses(ctx context.Context, r syncRange, userID uuid.UUID) ([]StatusChange, error) {
+	query := `
+	SELECT ms.message_id, ms.conversation_id, m.sender_id, ms.user_id, ms.status, ms.timestamp
+	FROM message_status ms
+	INNER JOIN messages m ON m.id = ms.message_id
+	WHERE ms.conversation_id = $1 AND ms.seq > $2 AND ms.seq <= $3
+		AND (m.sender_id = $4 OR ms.user_id = $4)
+	ORDER BY ms.seq
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, r.conversationID, r.from, r.to, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []StatusChange
+	for rows.Next() {
+		var change StatusChange
+		err := rows.Scan(
+			&change.MessageID,
+			&change.ConversationID,
+			&change.SenderID,
+			&change.UserID,
+			&change.Status,
+			&change.Timestamp,
+		)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+func (pg *PostgresSyncStore) changedMemberships(ctx context.Context, r syncRange) ([]ConversationParticipant, error) {
+	query := `
+	SELECT id, conversation_id, user_id, joined_at, left_at, role
+	FROM conversation_participants
+	WHERE conversation_id = $1 AND seq > $2 AND seq <= $3
+	ORDER BY seq
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, r.conversationID, r.from, r.to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var participants []ConversationParticipant
+	for rows.Next() {
+		var p ConversationParticipant
+		if err := rows.Scan(&p.ID, &p.ConversationID, &p.UserID, &p.JoinedAt, &p.LeftAt, &p.Role); err != nil {
+			return nil, err
+		}
+		participants = append(participants, p)
+	}
+	return participants, rows.Err()
+}
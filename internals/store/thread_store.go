@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// GetThreadReplies pages through the replies filed under rootID, oldest
+// first, the same way GetMessagesByConversationID pages a timeline.
+func (pg *PostgresMessageStore) GetThreadReplies(ctx context.Context, rootID uuid.UUID, viewerID uuid.UUID, limit int, cursor *MessageCursor, direction PageDirection) ([]Message, error) {
+	return pg.pageMessages(ctx, "m.thread_root_id = $1", rootID, viewerID, limit, cursor, direction)
+}
+
+// GetThreadUnreadCount counts replies from other users posted after userID
+// last read the thread.
+func (pg *PostgresMessageStore) GetThreadUnreadCount(ctx context.Context, rootID uuid.UUID, userID uuid.UUID) (int, error) {
+	query := `
+	SELECT COUNT(*)
+	FROM messages m
+	LEFT JOIN thread_reads tr
+		ON tr.root_message_id = m.thread_root_id AND tr.user_id = $2
+	WHERE m.thread_root_id = $1 AND m.sender_id != $2 AND m.deleted_at IS NULL
+		AND ` + notHiddenFor("$2") + `
+		AND (tr.last_read_at IS NULL OR m.created_at > tr.last_read_at)
+	`
+	var count int
+	err := pg.DB.QueryRowContext(ctx, query, rootID, userID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (pg *PostgresMessageStore) MarkThreadRead(ctx context.Context, rootID uuid.UUID, userID uuid.UUID) error {
+	query := `
+	INSERT INTO thread_reads (root_message_id, user_id, last_read_at)
+	VALUES ($1, $2, CURRENT_TIMESTAMP)
+	ON CONFLICT (root_message_id, user_id)
+	DO UPDATE SET last_read_at = EXCLUDED.last_read_at
+	`
+	_, err := pg.DB.ExecContext(ctx, query, rootID, userID)
+	return err
+}
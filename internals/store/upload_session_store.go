@@ -0,0 +1,197 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUploadSessionNotFound = errors.New("upload session not found")
+	ErrUploadOffsetMismatch  = errors.New("upload offset does not match")
+	ErrUploadSessionBusy     = errors.New("another request is writing to this upload")
+	ErrUploadQuotaExceeded   = errors.New("too many unfinished uploads")
+)
+
+// unlockTimeout bounds releasing a session lock, which happens after the
+// request that took it may already be cancelled.
+const unlockTimeout = 5 * time.Second
+
+// UploadSession tracks an upload sent in chunks.
+type UploadSession struct {
+	ID         uuid.UUID `json:"id"`
+	UploaderID uuid.UUID `json:"uploader_id"`
+	FileName   string    `json:"file_name"`
+	Length     int64     `json:"length"`
+	Offset     int64     `json:"offset"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Complete reports whether every byte of the upload has been received.
+func (s *UploadSession) Complete() bool {
+	return s.Offset == s.Length
+}
+
+const uploadSessionColumns = `id, uploader_id, file_name, upload_length, upload_offset, created_at, expires_at`
+
+func scanUploadSession(row rowScanner) (*UploadSession, error) {
+	session := &UploadSession{}
+	err := row.Scan(
+		&session.ID,
+		&session.UploaderID,
+		&session.FileName,
+		&session.Length,
+		&session.Offset,
+		&session.CreatedAt,
+		&session.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// CreateUploadSession starts a session unless its uploader would then have
+// more than maxSessions live sessions or more than maxBytes announced over
+// all of them, in which case it fails with ErrUploadQuotaExceeded.
+func (pg *PostgresUploadStore) CreateUploadSession(ctx context.Context, session *UploadSession, maxSessions int, maxBytes int64) (*UploadSession, error) {
+	tx, err := pg.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Serialize session creation per user so concurrent requests cannot
+	// both slip under the limits.
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1::text, 1))`, session.UploaderID); err != nil {
+		return nil, err
+	}
+	var count int
+	var reserved int64
+	err = tx.QueryRowContext(ctx, `
+	SELECT COUNT(*), COALESCE(SUM(upload_length), 0)
+	FROM upload_sessions
+	WHERE uploader_id = $1 AND expires_at > CURRENT_TIMESTAMP
+	`, session.UploaderID).Scan(&count, &reserved)
+	if err != nil {
+		return nil, err
+	}
+	if count >= maxSessions || reserved+session.Length > maxBytes {
+		return nil, ErrUploadQuotaExceeded
+	}
+
+	query := `
+	INSERT INTO upload_sessions (uploader_id, file_name, upload_length, expires_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING ` + uploadSessionColumns
+	created, err := scanUploadSession(tx.QueryRowContext(ctx, query,
+		session.UploaderID,
+		session.FileName,
+		session.Length,
+		session.ExpiresAt,
+	))
+	if err != nil {
+		return nil, err
+	}
+	return created, tx.Commit()
+}
+
+// LockUploadSession takes an exclusive lock on sessionID for writing to its
+// staging file, shared by every instance through a Postgres advisory lock.
+// It fails with ErrUploadSessionBusy rather than waiting when someone else
+// holds it. The lock pins a pooled connection until unlock is called.
+func (pg *PostgresUploadStore) LockUploadSession(ctx context.Context, sessionID uuid.UUID) (func(), error) {
+	conn, err := pg.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var locked bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtextextended($1::text, 0))`, sessionID).Scan(&locked)
+	if err != nil || !locked {
+		conn.Close()
+		if err == nil {
+			err = ErrUploadSessionBusy
+		}
+		return nil, err
+	}
+
+	unlock := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), unlockTimeout)
+		defer cancel()
+		_, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock(hashtextextended($1::text, 0))`, sessionID)
+		if err != nil {
+			// Never hand a connection that may still hold the lock back to
+			// the pool; dropping it releases the lock server-side.
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}
+	return unlock, nil
+}
+
+// GetUploadSession returns a live session of uploaderID. Other users'
+// sessions and expired ones are reported as not found.
+func (pg *PostgresUploadStore) GetUploadSession(ctx context.Context, sessionID uuid.UUID, uploaderID uuid.UUID) (*UploadSession, error) {
+	query := `
+	SELECT ` + uploadSessionColumns + `
+	FROM upload_sessions
+	WHERE id = $1 AND uploader_id = $2 AND expires_at > CURRENT_TIMESTAMP
+	`
+	session, err := scanUploadSession(pg.DB.QueryRowContext(ctx, query, sessionID, uploaderID))
+	if err == sql.ErrNoRows {
+		return nil, ErrUploadSessionNotFound
+	}
+	return session, err
+}
+
+// AdvanceUploadSession moves a session's offset from `from` to `to` and
+// pushes back its expiry. It fails with ErrUploadOffsetMismatch if the
+// offset was no longer `from`.
+func (pg *PostgresUploadStore) AdvanceUploadSession(ctx context.Context, sessionID uuid.UUID, from, to int64, expiresAt time.Time) (*UploadSession, error) {
+	query := `
+	UPDATE upload_sessions
+	SET upload_offset = $3, expires_at = $4
+	WHERE id = $1 AND upload_offset = $2
+	RETURNING ` + uploadSessionColumns
+	session, err := scanUploadSession(pg.DB.QueryRowContext(ctx, query, sessionID, from, to, expiresAt))
+	if err == sql.ErrNoRows {
+		return nil, ErrUploadOffsetMismatch
+	}
+	return session, err
+}
+
+func (pg *PostgresUploadStore) DeleteUploadSession(ctx context.Context, sessionID uuid.UUID) error {
+	_, err := pg.DB.ExecContext(ctx, `DELETE FROM upload_sessions WHERE id = $1`, sessionID)
+	return err
+}
+
+// ExpiredUploadSessions lists up to limit sessions whose expiry has passed.
+func (pg *PostgresUploadStore) ExpiredUploadSessions(ctx context.Context, limit int) ([]UploadSession, error) {
+	query := `
+	SELECT ` + uploadSessionColumns + `
+	FROM upload_sessions
+	WHERE expires_at <= CURRENT_TIMESTAMP
+	ORDER BY expires_at
+	LIMIT $1
+	`
+	rows, err := pg.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []UploadSession{}
+	for rows.Next() {
+		session, err := scanUploadSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
@@ -0,0 +1,299 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrUploadNotFound = errors.New("upload not found")
+
+type Upload struct {
+	ID         uuid.UUID  `json:"id"`
+	UploaderID uuid.UUID  `json:"uploader_id"`
+	StorageKey string     `json:"-"`
+	FileName   string     `json:"file_name"`
+	MimeType   string     `json:"mime_type"`
+	Size       int64      `json:"size"`
+	Width      *int       `json:"width,omitempty"`
+	Height     *int       `json:"height,omitempty"`
+	Thumbnails Thumbnails `json:"thumbnails,omitempty"`
+	MessageID  *uuid.UUID `json:"message_id,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// URL is where participants download the upload from. It is what messages
+// carrying the upload store as their media URL.
+func (u *Upload) URL() string {
+	return UploadURL(u.ID)
+}
+
+func UploadURL(id uuid.UUID) string {
+	return "/uploads/" + id.String()
+}
+
+// UploadKey is where an upload's bytes are kept in the blob store.
+func UploadKey(id uuid.UUID) string {
+	return "uploads/" + id.String()
+}
+
+func ThumbnailURL(id uuid.UUID, name string) string {
+	return UploadURL(id) + "/thumbnails/" + name
+}
+
+func ThumbnailKey(id uuid.UUID, name string) string {
+	return "thumbnails/" + id.String() + "/" + name
+}
+
+// Thumbnail is a resized copy of an uploaded image.
+type Thumbnail struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	MimeType string `json:"mime_type"`
+}
+
+// Thumbnails is stored as a JSONB column.
+type Thumbnails []Thumbnail
+
+func (t Thumbnails) Value() (driver.Value, error) {
+	if t == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (t *Thumbnails) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, t)
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	default:
+		return fmt.Errorf("cannot scan %T into Thumbnails", src)
+	}
+}
+
+// Find returns the thumbnail called name.
+func (t Thumbnails) Find(name string) (*Thumbnail, bool) {
+	for i := range t {
+		if t[i].Name == name {
+			return &t[i], true
+		}
+	}
+	return nil, false
+}
+
+// MessageTypeForMime picks how a message carrying a file of the given MIME
+// type is displayed.
+func MessageTypeForMime(mimeType string) MessageType {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return MessageTypeImage
+	case strings.HasPrefix(mimeType, "video/"):
+		return MessageTypeVideo
+	default:
+		return MessageTypeFile
+	}
+}
+
+type PostgresUploadStore struct {
+	DB *sql.DB
+}
+
+func NewPostgresUploadStore(db *sql.DB) *PostgresUploadStore {
+	return &PostgresUploadStore{DB: db}
+}
+
+type UploadStore interface {
+	CreateUpload(ctx context.Context, upload *Upload) (*Upload, error)
+	GetUpload(ctx context.Context, uploadID uuid.UUID) (*Upload, error)
+	CanDownloadUpload(ctx context.Context, uploadID uuid.UUID, userID uuid.UUID) (bool, error)
+	CreateUploadSession(ctx context.Context, session *UploadSession, maxSessions int, maxBytes int64) (*UploadSession, error)
+	LockUploadSession(ctx context.Context, sessionID uuid.UUID) (func(), error)
+	GetUploadSession(ctx context.Context, sessionID uuid.UUID, uploaderID uuid.UUID) (*UploadSession, error)
+	AdvanceUploadSession(ctx context.Context, sessionID uuid.UUID, from, to int64, expiresAt time.Time) (*UploadSession, error)
+	DeleteUploadSession(ctx context.Context, sessionID uuid.UUID) error
+	ExpiredUploadSessions(ctx context.Context, limit int) ([]UploadSession, error)
+	PendingBlobDeletions(ctx context.Context, limit int) ([]string, error)
+	ForgetBlobDeletions(ctx context.Context, keys []string) error
+}
+
+const uploadColumns = `id, uploader_id, storage_key, file_name, mime_type, size,
+	width, height, thumbnails, message_id, created_at`
+
+func scanUpload(row rowScanner) (*Upload, error) {
+	upload := &Upload{}
+	err := row.Scan(
+		&upload.ID,
+		&upload.UploaderID,
+		&upload.StorageKey,
+		&upload.FileName,
+		&upload.MimeType,
+		&upload.Size,
+		&upload.Width,
+		&upload.Height,
+		&upload.Thumbnails,
+		&upload.MessageID,
+		&upload.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+func (pg *PostgresUploadStore) CreateUpload(ctx context.Context, upload *Upload) (*Upload, error) {
+	query := `
+	INSERT INTO uploads (id, uploader_id, storage_key, file_name, mime_type, size,
+		width, height, thumbnails)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING ` + uploadColumns
+	return scanUpload(pg.DB.QueryRowContext(ctx, query,
+		upload.ID,
+		upload.UploaderID,
+		upload.StorageKey,
+		upload.FileName,
+		upload.MimeType,
+		upload.Size,
+		upload.Width,
+		upload.Height,
+		upload.Thumbnails,
+	))
+}
+
+func (pg *PostgresUploadStore) GetUpload(ctx context.Context, uploadID uuid.UUID) (*Upload, error) {
+	query := `SELECT ` + uploadColumns + ` FROM uploads WHERE id = $1`
+	upload, err := scanUpload(pg.DB.QueryRowContext(ctx, query, uploadID))
+	if err == sql.ErrNoRows {
+		return nil, ErrUploadNotFound
+	}
+	return upload, err
+}
+
+// CanDownloadUpload reports whether userID uploaded the file or is an
+// active participant of the conversation it was sent to.
+func (pg *PostgresUploadStore) CanDownloadUpload(ctx context.Context, uploadID uuid.UUID, userID uuid.UUID) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM uploads u
+		WHERE u.id = $1 AND u.uploader_id = $2
+	) OR EXISTS (
+		SELECT 1
+		FROM uploads u
+		JOIN messages m ON m.id = u.message_id
+		JOIN conversation_participants cp
+			ON cp.conversation_id = m.conversation_id
+			AND cp.user_id = $2 AND cp.left_at IS NULL
+		WHERE u.id = $1 AND m.deleted_at IS NULL
+	)
+	`
+	var ok bool
+	err := pg.DB.QueryRowContext(ctx, query, uploadID, userID).Scan(&ok)
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+// claimUpload locks an upload msg's sender has not sent yet and fills in
+// msg's media fields from it.
+func claimUpload(ctx context.Context, tx *sql.Tx, msg *Message) error {
+	var mimeType string
+	var size int64
+	err := tx.QueryRowContext(ctx, `
+	SELECT mime_type, size, width, height, thumbnails FROM uploads
+	WHERE id = $1 AND uploader_id = $2 AND message_id IS NULL
+	FOR UPDATE
+	`, *msg.UploadID, msg.SenderID).Scan(&mimeType, &size, &msg.MediaWidth, &msg.MediaHeight, &msg.Thumbnails)
+	if err == sql.ErrNoRows {
+		return ErrUploadNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	url := UploadURL(*msg.UploadID)
+	msg.MediaURL = &url
+	msg.MediaSize = &size
+	msg.MediaMimeType = &mimeType
+	msg.MessageType = MessageTypeForMime(mimeType)
+	return nil
+}
+
+// deleteMessageUpload removes the upload sent with messageID, if any, and
+// queues its file and thumbnails for removal from the blob store, so that
+// nobody can fetch them any longer.
+func deleteMessageUpload(ctx context.Context, tx *sql.Tx, messageID uuid.UUID) error {
+	var (
+		uploadID   uuid.UUID
+		storageKey string
+		thumbnails Thumbnails
+	)
+	err := tx.QueryRowContext(ctx, `
+	DELETE FROM uploads WHERE message_id = $1
+	RETURNING id, storage_key, thumbnails
+	`, messageID).Scan(&uploadID, &storageKey, &thumbnails)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	keys := []string{storageKey}
+	for _, thumbnail := range thumbnails {
+		keys = append(keys, ThumbnailKey(uploadID, thumbnail.Name))
+	}
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO blob_deletions (storage_key)
+	SELECT unnest($1::text[])
+	ON CONFLICT DO NOTHING
+	`, keys)
+	return err
+}
+
+// PendingBlobDeletions lists up to limit blob store keys waiting to be
+// removed, oldest first.
+func (pg *PostgresUploadStore) PendingBlobDeletions(ctx context.Context, limit int) ([]string, error) {
+	rows, err := pg.DB.QueryContext(ctx, `
+	SELECT storage_key FROM blob_deletions
+	ORDER BY created_at
+	LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// ForgetBlobDeletions marks keys as removed from the blob store.
+func (pg *PostgresUploadStore) ForgetBlobDeletions(ctx context.Context, keys []string) error {
+	_, err := pg.DB.ExecContext(ctx, `DELETE FROM blob_deletions WHERE storage_key = ANY($1::text[])`, keys)
+	return err
+}
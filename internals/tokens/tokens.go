@@ -38,3 +38,14 @@ func GenerateToken(UserId uuid.UUID, ttl time.Duration, scope string) (*Token, e
 	token.Hash = hex.EncodeToString(hash[:])
 	return token, nil
 }
+
+// GenerateCode returns a random code for links that are meant to be passed
+// around, such as group invites. Unlike tokens they are stored as is, so
+// their creators can see them again.
+func GenerateCode() (string, error) {
+	emptyBytes := make([]byte, 15)
+	if _, err := rand.Read(emptyBytes); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(emptyBytes), nil
+}
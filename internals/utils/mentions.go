@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	MentionAll  = "all"
+	MentionHere = "here"
+)
+
+// mentionPattern matches @name at the start of the text or after a
+// character that can't be part of a word, so e-mail addresses are not
+// mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@.])@([\w][\w.-]{0,63})`)
+
+// ParseMentions returns the distinct names mentioned with @name in content,
+// in order of first appearance. Trailing punctuation such as the dot ending
+// a sentence is not part of the name.
+func ParseMentions(content string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		name := strings.TrimRight(match[1], ".-")
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
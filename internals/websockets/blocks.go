@@ -0,0 +1,59 @@
+package websockets
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// withoutBlockers drops from userIDs everyone who has blocked senderID, so
+// that what the sender does never reaches them.
+func (m *Manager) withoutBlockers(ctx context.Context, senderID uuid.UUID, userIDs []uuid.UUID) ([]uuid.UUID, error) {
+	blockers, err := m.blockStore.GetBlockerIDs(ctx, senderID)
+	if err != nil || len(blockers) == 0 {
+		return userIDs, err
+	}
+	return excludeUsers(userIDs, blockers), nil
+}
+
+// broadcastToConversationFrom is BroadcastToConversation for an event
+// caused by actorIDs: participants who blocked any of them are left out.
+func (m *Manager) broadcastToConversationFrom(ctx context.Context, conversationID uuid.UUID, actorIDs []uuid.UUID, eventType string, payload any) error {
+	participants, err := m.conversationStore.GetConversationParticipants(ctx, conversationID)
+	if err != nil {
+		return err
+	}
+	seen := make(map[uuid.UUID]bool, len(actorIDs))
+	for _, actorID := range actorIDs {
+		if seen[actorID] {
+			continue
+		}
+		seen[actorID] = true
+		participants, err = m.withoutBlockers(ctx, actorID, participants)
+		if err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	m.broadcastToUsers(participants, Event{Type: eventType, Payload: data})
+	return nil
+}
+
+// excludeUsers returns userIDs without any of excluded.
+func excludeUsers(userIDs []uuid.UUID, excluded []uuid.UUID) []uuid.UUID {
+	skip := make(map[uuid.UUID]bool, len(excluded))
+	for _, id := range excluded {
+		skip[id] = true
+	}
+	kept := make([]uuid.UUID, 0, len(userIDs))
+	for _, id := range userIDs {
+		if !skip[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
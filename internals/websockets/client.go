@@ -5,6 +5,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -13,6 +14,12 @@ var (
 	pingInterval = (pongWait * 8) / 10
 )
 
+// maxEventSize bounds what a client may send in one frame. It fits a
+// send_message of store.MaxMessageRunes runes even if every rune arrives as
+// a JSON-escaped surrogate pair, so over-long content reaches the store and
+// is refused with an error event rather than closing the connection.
+const maxEventSize = 64 << 10
+
 type ClientList map[*Client]bool
 
 type Client struct {
@@ -20,16 +27,21 @@ type Client struct {
 	Manager    *Manager
 	Logger     *log.Logger
 	egress     chan Event
-	chatroom   string
-	UserID     string
+	presence   PresenceStatus
+	// threads holds the roots of the threads this client follows; guarded
+	// by the Manager's lock.
+	threads map[uuid.UUID]bool
+	UserID  uuid.UUID
 }
 
-func NewClient(connection *websocket.Conn, manager *Manager, logger *log.Logger, userID string) *Client {
+func NewClient(connection *websocket.Conn, manager *Manager, logger *log.Logger, userID uuid.UUID) *Client {
 	return &Client{
 		Connection: connection,
 		Manager:    manager,
 		Logger:     logger,
 		egress:     make(chan Event, 10),
+		presence:   PresenceOnline,
+		threads:    make(map[uuid.UUID]bool),
 		UserID:     userID,
 	}
 }
@@ -40,7 +52,7 @@ func (c *Client) ReadMessages() {
 	defer func() {
 		c.Manager.RemoveClient(c)
 	}()
-	c.Connection.SetReadLimit(512)
+	c.Connection.SetReadLimit(maxEventSize)
 	if err := c.Connection.SetReadDeadline(time.Now().Add(pongWait)); err != nil {
 		log.Println(err)
 		return
@@ -101,6 +113,29 @@ func (c *Client) WriteMessages() {
 	}
 }
 
+// send queues event for this client only. It is a no-op once the client has
+// been removed from its manager.
+func (c *Client) send(event Event) {
+	c.Manager.RLock()
+	defer c.Manager.RUnlock()
+	if _, ok := c.Manager.clientsList[c]; !ok {
+		return
+	}
+	select {
+	case c.egress <- event:
+	default:
+		c.Logger.Println("egress full, dropping event for client", c.UserID)
+	}
+}
+
+func (c *Client) sendError(eventType, message string) {
+	data, err := json.Marshal(ErrorEvent{Event: eventType, Message: message})
+	if err != nil {
+		return
+	}
+	c.send(Event{Type: EventError, Payload: data})
+}
+
 func (c *Client) pongHandler(pongMsg string) error {
 	c.Logger.Println("pong")
 	return c.Connection.SetReadDeadline(time.Now().Add(pongWait))
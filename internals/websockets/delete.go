@@ -0,0 +1,69 @@
+package websockets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-chat/internals/store"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DeleteMessageEvent struct {
+	MessageID uuid.UUID         `json:"message_id"`
+	Scope     store.DeleteScope `json:"scope"`
+}
+
+// MessageDeletedEvent is the tombstone clients replace a deleted message
+// with. Deletions for one user only go to that user's own devices.
+type MessageDeletedEvent struct {
+	MessageID      uuid.UUID         `json:"message_id"`
+	ConversationID uuid.UUID         `json:"conversation_id"`
+	Scope          store.DeleteScope `json:"scope"`
+	DeletedAt      time.Time         `json:"deleted_at"`
+}
+
+func DeleteMessageHandler(event Event, c *Client) error {
+	var deleteEvent DeleteMessageEvent
+	if err := json.Unmarshal(event.Payload, &deleteEvent); err != nil {
+		c.sendError(event.Type, "bad payload in request")
+		return fmt.Errorf("bad payload in request: %v", err)
+	}
+	if deleteEvent.Scope == "" {
+		deleteEvent.Scope = store.DeleteForMe
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+
+	msg, err := c.Manager.messageStore.DeleteMessage(ctx, deleteEvent.MessageID, c.UserID, deleteEvent.Scope)
+	if err != nil {
+		return c.reportError(event.Type, err)
+	}
+	return c.Manager.BroadcastMessageDeleted(ctx, msg, c.UserID, deleteEvent.Scope)
+}
+
+// BroadcastMessageDeleted sends the tombstone for msg to everyone who should
+// stop seeing it. Tombstones go to users who blocked the sender as well:
+// they carry no content, and remove copies received before the block.
+func (m *Manager) BroadcastMessageDeleted(ctx context.Context, msg *store.Message, userID uuid.UUID, scope store.DeleteScope) error {
+	deleted := MessageDeletedEvent{
+		MessageID:      msg.ID,
+		ConversationID: msg.ConversationID,
+		Scope:          scope,
+		DeletedAt:      time.Now(),
+	}
+	if msg.DeletedAt != nil {
+		deleted.DeletedAt = *msg.DeletedAt
+	}
+	if scope == store.DeleteForEveryone {
+		return m.BroadcastToConversation(ctx, msg.ConversationID, EventMessageDeleted, deleted)
+	}
+	data, err := json.Marshal(deleted)
+	if err != nil {
+		return err
+	}
+	m.broadcastToUsers([]uuid.UUID{userID}, Event{Type: EventMessageDeleted, Payload: data})
+	return nil
+}
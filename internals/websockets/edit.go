@@ -0,0 +1,59 @@
+package websockets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-chat/internals/store"
+
+	"github.com/google/uuid"
+)
+
+type EditMessageEvent struct {
+	MessageID uuid.UUID `json:"message_id"`
+	Message   string    `json:"message"`
+}
+
+type MessageEditedEvent struct {
+	store.Message
+}
+
+func EditMessageHandler(event Event, c *Client) error {
+	var editEvent EditMessageEvent
+	if err := json.Unmarshal(event.Payload, &editEvent); err != nil {
+		c.sendError(event.Type, "bad payload in request")
+		return fmt.Errorf("bad payload in request: %v", err)
+	}
+	if editEvent.Message == "" {
+		c.sendError(event.Type, "message is required")
+		return fmt.Errorf("bad payload in request: empty message")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+
+	msg, err := c.Manager.messageStore.EditMessage(ctx, editEvent.MessageID, c.UserID, editEvent.Message)
+	if err != nil {
+		return c.reportError(event.Type, err)
+	}
+	return c.Manager.BroadcastMessageEdited(ctx, msg)
+}
+
+// BroadcastMessageEdited sends the new version of msg to the participants
+// of its conversation, leaving out those who blocked its sender.
+func (m *Manager) BroadcastMessageEdited(ctx context.Context, msg *store.Message) error {
+	participants, err := m.conversationStore.GetConversationParticipants(ctx, msg.ConversationID)
+	if err != nil {
+		return err
+	}
+	participants, err = m.withoutBlockers(ctx, msg.SenderID, participants)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(MessageEditedEvent{Message: *msg})
+	if err != nil {
+		return err
+	}
+	m.broadcastToUsers(participants, Event{Type: EventMessageEdited, Payload: data})
+	return nil
+}
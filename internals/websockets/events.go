@@ -1,9 +1,14 @@
 package websockets
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go-chat/internals/store"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 type Event struct {
@@ -17,15 +22,95 @@ const (
 	EventSeedMessage = "new_message"
 	EventChangeRoom  = "change_room"
 	EventSendMessage = "send_message"
+	EventRoomChanged = "room_changed"
+	EventError       = "error"
+
+	EventMarkRead      = "mark_read"
+	EventMessageStatus = "message_status"
+
+	EventTypingStart = "typing_start"
+	EventTypingStop  = "typing_stop"
+
+	EventSetPresence = "set_presence"
+	EventPresence    = "presence"
+
+	EventSync = "sync"
+
+	EventEditMessage   = "edit_message"
+	EventMessageEdited = "message_edited"
+
+	EventDeleteMessage  = "delete_message"
+	EventMessageDeleted = "message_deleted"
+
+	EventReact           = "react"
+	EventUnreact         = "unreact"
+	EventReactionUpdated = "reaction_updated"
+
+	EventFollowThread   = "follow_thread"
+	EventUnfollowThread = "unfollow_thread"
+	EventMarkThreadRead = "mark_thread_read"
+	EventThreadReply    = "thread_reply"
+	EventThreadUpdated  = "thread_updated"
+
+	EventMention = "mention"
+
+	EventPinUpdated = "pin_updated"
+
+	EventGroupUpdated  = "group_updated"
+	EventJoinRequested = "join_requested"
 )
 
+// eventTimeout bounds the database work done while handling a single event.
+const eventTimeout = 5 * time.Second
+
 type SendMessageEvent struct {
-	Message string `json:"message"`
-	From    string `json:"from"`
+	ConversationID   uuid.UUID  `json:"conversation_id"`
+	Message          string     `json:"message"`
+	ReplyToMessageID *uuid.UUID `json:"reply_to_message_id,omitempty"`
+	// UploadID attaches a file from POST /uploads; Message is then an
+	// optional caption.
+	UploadID *uuid.UUID `json:"upload_id,omitempty"`
 }
+
 type NewMessageEvent struct {
-	SendMessageEvent
-	Sent time.Time `json:"sent"`
+	store.Message
+}
+
+// ErrorEvent is sent back to a client when one of its events is rejected.
+type ErrorEvent struct {
+	Event   string `json:"event"`
+	Message string `json:"message"`
+}
+
+// userFacingErrors are store errors whose text is safe to show clients.
+var userFacingErrors = []error{
+	store.ErrNotParticipant,
+	store.ErrInvalidCursor,
+	store.ErrMessageNotFound,
+	store.ErrNotMessageSender,
+	store.ErrEditWindowExpired,
+	store.ErrMessageDeleted,
+	store.ErrInvalidDeleteScope,
+	store.ErrMessageTooLong,
+	store.ErrInvalidReaction,
+	store.ErrUploadNotFound,
+	store.ErrNotAdmin,
+	store.ErrTooManyPins,
+	store.ErrNotPinned,
+	store.ErrAlreadyPinned,
+	store.ErrSystemMessage,
+}
+
+// reportError tells the client why its event failed when err is one of
+// userFacingErrors, and returns err for logging either way.
+func (c *Client) reportError(eventType string, err error) error {
+	for _, known := range userFacingErrors {
+		if errors.Is(err, known) {
+			c.sendError(eventType, known.Error())
+			break
+		}
+	}
+	return err
 }
 
 func SendMessageHandler(event Event, c *Client) error {
@@ -33,52 +118,105 @@ func SendMessageHandler(event Event, c *Client) error {
 	if err := json.Unmarshal(event.Payload, &chatevent); err != nil {
 		return err
 	}
-
-	broadMessage := NewMessageEvent{
-		SendMessageEvent: SendMessageEvent{
-			Message: chatevent.Message,
-			From:    c.UserID,
-		},
-		Sent: time.Now(),
+	if chatevent.ConversationID == uuid.Nil || (chatevent.Message == "" && chatevent.UploadID == nil) {
+		return fmt.Errorf("bad payload in request: conversation_id and message or upload_id are required")
 	}
 
-	data, _ := json.Marshal(broadMessage)
-	outgoingEvent := Event{
-		Type:    EventSeedMessage,
-		Payload: data,
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+
+	participants, err := c.Manager.conversationStore.GetConversationParticipants(ctx, chatevent.ConversationID)
+	if err != nil {
+		return err
 	}
 
-	var toRemove []*Client
+	msg, err := c.Manager.messageStore.CreateMessage(ctx, &store.Message{
+		ConversationID:   chatevent.ConversationID,
+		SenderID:         c.UserID,
+		Content:          chatevent.Message,
+		MessageType:      store.MessageTypeText,
+		ReplyToMessageID: chatevent.ReplyToMessageID,
+		UploadID:         chatevent.UploadID,
+	})
+	if errors.Is(err, store.ErrNotParticipant) {
+		c.sendError(event.Type, "you are not a participant of this conversation")
+		return fmt.Errorf("user %s cannot send to conversation %s: %w", c.UserID, chatevent.ConversationID, err)
+	}
+	if err != nil {
+		return c.reportError(event.Type, err)
+	}
+	// Users who blocked the sender get neither the message nor anything
+	// that follows from it.
+	participants, err = c.Manager.withoutBlockers(ctx, c.UserID, participants)
+	if err != nil {
+		return err
+	}
+	mentioned, err := c.Manager.notifyMentions(ctx, msg, participants)
+	if err != nil {
+		c.Logger.Println("error notifying mentions:", err)
+	}
+	if msg.ThreadRootID != nil {
+		// Offline users only hear about thread replies that mention them.
+		if err := c.Manager.notifyOffline(ctx, msg, mentioned, mentioned); err != nil {
+			c.Logger.Println("error sending notifications:", err)
+		}
+		return c.Manager.broadcastThreadReply(ctx, c, msg, participants)
+	}
 
-	c.Manager.RLock()
-	for client := range c.Manager.clientsList {
-		if client.chatroom == c.chatroom {
-			select {
-			case client.egress <- outgoingEvent:
-			default:
-				toRemove = append(toRemove, client)
-			}
+	recipients := make([]uuid.UUID, 0, len(participants))
+	for _, id := range participants {
+		if id != c.UserID {
+			recipients = append(recipients, id)
 		}
 	}
-	c.Manager.RUnlock()
+	if err := c.Manager.messageStore.CreateMessageStatus(ctx, msg.ID, recipients); err != nil {
+		return err
+	}
 
-	for _, client := range toRemove {
-		c.Manager.RemoveClient(client)
+	data, err := json.Marshal(NewMessageEvent{Message: *msg})
+	if err != nil {
+		return err
+	}
+	c.Manager.stopTyping(msg.ConversationID, c.UserID, participants)
+	c.Manager.broadcastToUsers(participants, Event{
+		Type:    EventSeedMessage,
+		Payload: data,
+	})
+	if err := c.Manager.notifyOffline(ctx, msg, recipients, mentioned); err != nil {
+		c.Logger.Println("error sending notifications:", err)
 	}
 	return nil
 }
 
 type ChangeRoomEvent struct {
-	Name string `json:"name"`
+	ConversationID uuid.UUID `json:"conversation_id"`
 }
 
+// ChatRoomHandler only checks that the user may open the conversation and
+// confirms it with room_changed. Delivery is not scoped by it: every client
+// receives the events of all of its user's conversations.
 func ChatRoomHandler(event Event, c *Client) error {
 	var changeRoomEvent ChangeRoomEvent
 	if err := json.Unmarshal(event.Payload, &changeRoomEvent); err != nil {
+		c.sendError(event.Type, "bad payload in request")
 		return fmt.Errorf("bad payload in request: %v", err)
 	}
-	c.chatroom = changeRoomEvent.Name
 
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
 
+	ok, err := c.Manager.conversationStore.IsParticipant(ctx, changeRoomEvent.ConversationID, c.UserID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		c.sendError(event.Type, "you are not a participant of this conversation")
+		return fmt.Errorf("user %s denied access to conversation %s", c.UserID, changeRoomEvent.ConversationID)
+	}
+	data, err := json.Marshal(changeRoomEvent)
+	if err != nil {
+		return err
+	}
+	c.send(Event{Type: EventRoomChanged, Payload: data})
+	return nil
 }
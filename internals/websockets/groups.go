@@ -0,0 +1,68 @@
+package websockets
+
+import (
+	"context"
+	"encoding/json"
+	"go-chat/internals/store"
+
+	"github.com/google/uuid"
+)
+
+// GroupUpdatedEvent carries a group's name and membership after a change,
+// so clients can refresh their copy without refetching.
+type GroupUpdatedEvent struct {
+	Conversation store.Conversation              `json:"conversation"`
+	Members      []store.ConversationParticipant `json:"members"`
+}
+
+// BroadcastGroupChange sends the system messages recording a group change,
+// followed by the group's new state, to its members. Users the change
+// removed get the same events once more so their clients learn why the
+// conversation went quiet.
+func (m *Manager) BroadcastGroupChange(ctx context.Context, change *store.GroupChange) error {
+	members, err := m.conversationStore.GetConversationMembers(ctx, change.Conversation.ID)
+	if err != nil {
+		return err
+	}
+	recipients := make([]uuid.UUID, 0, len(members)+len(change.Removed))
+	for _, member := range members {
+		recipients = append(recipients, member.UserID)
+	}
+	recipients = append(recipients, change.Removed...)
+
+	for _, msg := range change.Messages {
+		data, err := json.Marshal(NewMessageEvent{Message: msg})
+		if err != nil {
+			return err
+		}
+		m.broadcastToUsers(recipients, Event{Type: EventSeedMessage, Payload: data})
+	}
+
+	data, err := json.Marshal(GroupUpdatedEvent{Conversation: *change.Conversation, Members: members})
+	if err != nil {
+		return err
+	}
+	m.broadcastToUsers(recipients, Event{Type: EventGroupUpdated, Payload: data})
+	return nil
+}
+
+// BroadcastJoinRequested tells a group's admins that someone asked to join
+// through an invite.
+func (m *Manager) BroadcastJoinRequested(ctx context.Context, request *store.JoinRequest) error {
+	members, err := m.conversationStore.GetConversationMembers(ctx, request.ConversationID)
+	if err != nil {
+		return err
+	}
+	var admins []uuid.UUID
+	for _, member := range members {
+		if member.Role == store.ParticipantRoleAdmin {
+			admins = append(admins, member.UserID)
+		}
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	m.broadcastToUsers(admins, Event{Type: EventJoinRequested, Payload: data})
+	return nil
+}
@@ -1,12 +1,18 @@
 package websockets
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"go-chat/internals/contexkeys"
+	"go-chat/internals/pubsub"
+	"go-chat/internals/push"
+	"go-chat/internals/store"
 	"log"
 	"net/http"
 	"sync"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -25,22 +31,74 @@ var (
 type Manager struct {
 	logger      *log.Logger
 	clientsList ClientList
+	// userClients indexes clientsList by user so per-user operations only
+	// touch that user's devices.
+	userClients map[uuid.UUID]ClientList
 	sync.RWMutex
-	handlers map[string]EventHandler
+	handlers          map[string]EventHandler
+	messageStore      store.MessageStore
+	conversationStore store.ConversationStore
+	userStore         store.UserStore
+	syncStore         store.SyncStore
+	blockStore        store.BlockStore
+	presenceStore     store.PresenceStore
+	notifier          push.Notifier
+	broker            pubsub.Broker
+	typing            *typingTracker
+
+	// instanceID tells this instance's presence records apart from those
+	// of the others; presenceWrites orders writing them.
+	instanceID     uuid.UUID
+	presenceWrites sync.Mutex
+}
+
+// brokerEnvelope is what instances exchange over the broker: an event and
+// the users it is meant for. When ThreadID is set only those users' clients
+// following that thread receive it.
+type brokerEnvelope struct {
+	UserIDs  []uuid.UUID `json:"user_ids"`
+	ThreadID *uuid.UUID  `json:"thread_id,omitempty"`
+	Event    Event       `json:"event"`
 }
 
-func NewManager(Logger *log.Logger) *Manager {
+func NewManager(Logger *log.Logger, messageStore store.MessageStore, conversationStore store.ConversationStore, userStore store.UserStore, syncStore store.SyncStore, blockStore store.BlockStore, presenceStore store.PresenceStore, notifier push.Notifier, broker pubsub.Broker) (*Manager, error) {
 	m := &Manager{
-		logger:      Logger,
-		clientsList: make(ClientList),
-		handlers:    make(map[string]EventHandler),
+		logger:            Logger,
+		clientsList:       make(ClientList),
+		userClients:       make(map[uuid.UUID]ClientList),
+		handlers:          make(map[string]EventHandler),
+		messageStore:      messageStore,
+		conversationStore: conversationStore,
+		userStore:         userStore,
+		syncStore:         syncStore,
+		blockStore:        blockStore,
+		presenceStore:     presenceStore,
+		notifier:          notifier,
+		broker:            broker,
+		typing:            newTypingTracker(),
+		instanceID:        uuid.New(),
 	}
 	m.SetUpEventHandlers()
-	return m
+	if err := broker.Subscribe(m.handleBrokerPayload); err != nil {
+		return nil, err
+	}
+	return m, nil
 }
 func (m *Manager) SetUpEventHandlers() {
 	m.handlers[EventSendMessage] = SendMessageHandler
 	m.handlers[EventChangeRoom] = ChatRoomHandler
+	m.handlers[EventMarkRead] = MarkReadHandler
+	m.handlers[EventTypingStart] = TypingStartHandler
+	m.handlers[EventTypingStop] = TypingStopHandler
+	m.handlers[EventSetPresence] = SetPresenceHandler
+	m.handlers[EventSync] = SyncHandler
+	m.handlers[EventEditMessage] = EditMessageHandler
+	m.handlers[EventDeleteMessage] = DeleteMessageHandler
+	m.handlers[EventReact] = ReactHandler
+	m.handlers[EventUnreact] = UnreactHandler
+	m.handlers[EventFollowThread] = FollowThreadHandler
+	m.handlers[EventUnfollowThread] = UnfollowThreadHandler
+	m.handlers[EventMarkThreadRead] = MarkThreadReadHandler
 }
 
 func (m *Manager) routeEvent(e Event, c *Client) error {
@@ -55,8 +113,8 @@ func (m *Manager) routeEvent(e Event, c *Client) error {
 }
 
 func (m *Manager) ServeWS(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(contexkeys.UserID).(string)
-	if !ok || userID == "" {
+	userID, ok := r.Context().Value(contexkeys.UserID).(uuid.UUID)
+	if !ok || userID == uuid.Nil {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -78,20 +136,161 @@ func (m *Manager) ServeWS(w http.ResponseWriter, r *http.Request) {
 
 func (m *Manager) AddClient(client *Client) {
 	m.Lock()
-	defer m.Unlock()
+	before := m.presenceLocked(client.UserID)
 	m.clientsList[client] = true
+	if _, ok := m.userClients[client.UserID]; !ok {
+		m.userClients[client.UserID] = make(ClientList)
+	}
+	m.userClients[client.UserID][client] = true
+	after := m.presenceLocked(client.UserID)
+	m.Unlock()
 
+	if before != after {
+		go m.publishPresence(client.UserID)
+	}
 }
 
 func (m *Manager) RemoveClient(client *Client) {
 	m.Lock()
-	defer m.Unlock()
+	if _, ok := m.clientsList[client]; !ok {
+		m.Unlock()
+		return
+	}
+	before := m.presenceLocked(client.UserID)
+	client.Connection.Close()
+	close(client.egress)
+	delete(m.clientsList, client)
+	delete(m.userClients[client.UserID], client)
+	if len(m.userClients[client.UserID]) == 0 {
+		delete(m.userClients, client.UserID)
+	}
+	after := m.presenceLocked(client.UserID)
+	m.Unlock()
+
+	m.logger.Println("client disconnected")
+	if before != after {
+		go m.publishPresence(client.UserID)
+	}
+}
+
+// broadcastToUsers sends event to every connected client of userIDs, on
+// whichever instance they are connected to.
+func (m *Manager) broadcastToUsers(userIDs []uuid.UUID, event Event) {
+	m.publish(brokerEnvelope{UserIDs: userIDs, Event: event})
+}
+
+func (m *Manager) publish(envelope brokerEnvelope) {
+	if len(envelope.UserIDs) == 0 {
+		return
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		m.logger.Println("error marshalling broker envelope:", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+	if err := m.broker.Publish(ctx, data); err != nil {
+		// Other instances miss out, but clients here still get the event
+		// rather than nobody.
+		m.logger.Println("error publishing event, delivering locally only:", err)
+		m.handleBrokerPayload(data)
+	}
+}
+
+// BroadcastToConversation sends an event with payload to every active
+// participant of a conversation.
+func (m *Manager) BroadcastToConversation(ctx context.Context, conversationID uuid.UUID, eventType string, payload any) error {
+	participants, err := m.conversationStore.GetConversationParticipants(ctx, conversationID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	m.broadcastToUsers(participants, Event{Type: eventType, Payload: data})
+	return nil
+}
+
+func (m *Manager) handleBrokerPayload(payload []byte) {
+	var envelope brokerEnvelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		m.logger.Println("error unmarshalling broker envelope:", err)
+		return
+	}
+	reached := m.deliverLocal(envelope.UserIDs, envelope.ThreadID, envelope.Event)
+	if envelope.Event.Type == EventSeedMessage && len(reached) > 0 {
+		var newMessage NewMessageEvent
+		if err := json.Unmarshal(envelope.Event.Payload, &newMessage); err != nil {
+			m.logger.Println("error unmarshalling new message:", err)
+			return
+		}
+		go m.markDelivered(&newMessage.Message, reached)
+	}
+}
+
+// deliverLocal queues event on this instance's clients belonging to one of
+// userIDs, limited to those following threadID when it is set, and returns
+// the users reached on at least one client. Clients whose egress buffer is
+// full are dropped.
+func (m *Manager) deliverLocal(userIDs []uuid.UUID, threadID *uuid.UUID, event Event) []uuid.UUID {
+	var toRemove []*Client
+	var delivered []uuid.UUID
+	seen := make(map[uuid.UUID]bool, len(userIDs))
+
+	m.RLock()
+	for _, userID := range userIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		reached := false
+		for client := range m.userClients[userID] {
+			if threadID != nil && !client.threads[*threadID] {
+				continue
+			}
+			select {
+			case client.egress <- event:
+				reached = true
+			default:
+				toRemove = append(toRemove, client)
+			}
+		}
+		if reached {
+			delivered = append(delivered, userID)
+		}
+	}
+	m.RUnlock()
+
+	for _, client := range toRemove {
+		m.RemoveClient(client)
+	}
+	return delivered
+}
+
+// IsOnline reports whether userID has at least one live client on any
+// instance.
+func (m *Manager) IsOnline(ctx context.Context, userID uuid.UUID) (bool, error) {
+	statuses, err := m.clusterPresence(ctx, []uuid.UUID{userID})
+	if err != nil {
+		return false, err
+	}
+	_, ok := statuses[userID]
+	return ok, nil
+}
+
+// DisconnectUser closes every connection userID has open.
+func (m *Manager) DisconnectUser(userID uuid.UUID) {
+	m.RLock()
+	clients := make([]*Client, 0, len(m.userClients[userID]))
+	for client := range m.userClients[userID] {
+		clients = append(clients, client)
+	}
+	m.RUnlock()
 
-	if _, ok := m.clientsList[client]; ok {
-		client.Connection.Close()
-		close(client.egress)
-		delete(m.clientsList, client)
-		m.logger.Println("client disconnected")
+	for _, client := range clients {
+		m.RemoveClient(client)
 	}
 }
 
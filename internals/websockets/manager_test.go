@@ -0,0 +1,124 @@
+package websockets
+
+import (
+	"context"
+	"errors"
+	"go-chat/internals/pubsub"
+	"go-chat/internals/push"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newTestManager(t *testing.T, broker pubsub.Broker) *Manager {
+	t.Helper()
+	m, err := NewManager(log.New(io.Discard, "", 0), nil, nil, nil, nil, nil, nil, push.NopNotifier{}, broker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// attachClient registers a client of userID on m without a connection, the
+// way AddClient does minus presence.
+func attachClient(m *Manager, userID uuid.UUID) *Client {
+	c := &Client{
+		Manager:  m,
+		egress:   make(chan Event, 8),
+		presence: PresenceOnline,
+		threads:  make(map[uuid.UUID]bool),
+		UserID:   userID,
+	}
+	m.Lock()
+	m.clientsList[c] = true
+	if m.userClients[userID] == nil {
+		m.userClients[userID] = make(ClientList)
+	}
+	m.userClients[userID][c] = true
+	m.Unlock()
+	return c
+}
+
+func expectEvent(t *testing.T, c *Client, eventType string) {
+	t.Helper()
+	select {
+	case event := <-c.egress:
+		if event.Type != eventType {
+			t.Fatalf("client of %s got %q, want %q", c.UserID, event.Type, eventType)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("client of %s got nothing, want %q", c.UserID, eventType)
+	}
+}
+
+func expectNothing(t *testing.T, c *Client) {
+	t.Helper()
+	select {
+	case event := <-c.egress:
+		t.Fatalf("client of %s got unexpected %q", c.UserID, event.Type)
+	default:
+	}
+}
+
+func TestBroadcastReachesClientsOnEveryInstance(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	first, second := newTestManager(t, broker), newTestManager(t, broker)
+
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	alicePhone := attachClient(first, alice)
+	aliceLaptop := attachClient(second, alice)
+	bobClient := attachClient(second, bob)
+	carolClient := attachClient(first, carol)
+
+	first.broadcastToUsers([]uuid.UUID{alice, bob}, Event{Type: EventTypingStart, Payload: []byte(`{}`)})
+
+	expectEvent(t, alicePhone, EventTypingStart)
+	expectEvent(t, aliceLaptop, EventTypingStart)
+	expectEvent(t, bobClient, EventTypingStart)
+	expectNothing(t, alicePhone)
+	expectNothing(t, carolClient)
+}
+
+func TestThreadEventsOnlyReachFollowers(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	first, second := newTestManager(t, broker), newTestManager(t, broker)
+
+	alice := uuid.New()
+	following := attachClient(second, alice)
+	notFollowing := attachClient(first, alice)
+	threadID := uuid.New()
+	second.Lock()
+	following.threads[threadID] = true
+	second.Unlock()
+
+	first.publish(brokerEnvelope{
+		UserIDs:  []uuid.UUID{alice},
+		ThreadID: &threadID,
+		Event:    Event{Type: EventThreadReply, Payload: []byte(`{}`)},
+	})
+
+	expectEvent(t, following, EventThreadReply)
+	expectNothing(t, notFollowing)
+}
+
+// failingBroker delivers nothing and fails every publish.
+type failingBroker struct{}
+
+func (failingBroker) Publish(ctx context.Context, payload []byte) error {
+	return errors.New("broker is down")
+}
+func (failingBroker) Subscribe(handler func(payload []byte)) error { return nil }
+func (failingBroker) Close() error                                 { return nil }
+
+func TestPublishFailureStillDeliversLocally(t *testing.T) {
+	m := newTestManager(t, failingBroker{})
+	alice := uuid.New()
+	client := attachClient(m, alice)
+
+	m.broadcastToUsers([]uuid.UUID{alice}, Event{Type: EventTypingStop, Payload: []byte(`{}`)})
+
+	expectEvent(t, client, EventTypingStop)
+}
@@ -0,0 +1,111 @@
+package websockets
+
+import (
+	"context"
+	"encoding/json"
+	"go-chat/internals/store"
+	"go-chat/internals/utils"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxMentionLookups bounds the user lookups done for a single message.
+const maxMentionLookups = 20
+
+// MentionEvent is sent only to the users a new message mentions, on top of
+// the regular new_message or thread_reply.
+type MentionEvent struct {
+	Message store.Message `json:"message"`
+	Kind    string        `json:"kind"`
+}
+
+// notifyMentions records who msg mentions, sends them a mention event and
+// returns them. @all mentions every participant of a group and @here those
+// of them currently online; in direct conversations both are plain text.
+// Only users in participants can be mentioned, so callers drop those who
+// must not hear from the sender, such as users who blocked them, first.
+func (m *Manager) notifyMentions(ctx context.Context, msg *store.Message, participants []uuid.UUID) ([]uuid.UUID, error) {
+	names := utils.ParseMentions(msg.Content)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if len(names) > maxMentionLookups {
+		names = names[:maxMentionLookups]
+	}
+	isParticipant := make(map[uuid.UUID]bool, len(participants))
+	for _, userID := range participants {
+		isParticipant[userID] = true
+	}
+
+	var mentions []store.Mention
+	var conversation *store.Conversation
+	var presence map[uuid.UUID]PresenceStatus
+	for _, name := range names {
+		if name == utils.MentionAll || name == utils.MentionHere {
+			if conversation == nil {
+				var err error
+				conversation, err = m.conversationStore.GetConversation(ctx, msg.ConversationID)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if conversation.Type != store.ConversationTypeGroup {
+				continue
+			}
+			if name == utils.MentionHere && presence == nil {
+				var err error
+				presence, err = m.clusterPresence(ctx, participants)
+				if err != nil {
+					return nil, err
+				}
+			}
+			for _, userID := range participants {
+				// @here reaches those online, not away, on any instance.
+				if name == utils.MentionHere && presence[userID] != PresenceOnline {
+					continue
+				}
+				mentions = append(mentions, store.Mention{UserID: userID, Kind: name})
+			}
+			continue
+		}
+		user, err := m.userStore.GetUserByUserNameOrEmail(name)
+		if err != nil || user == nil || !isParticipant[user.ID] {
+			continue
+		}
+		mentions = append(mentions, store.Mention{UserID: user.ID, Kind: store.MentionKindUser})
+	}
+
+	kept, err := m.messageStore.AddMentions(ctx, msg.ID, mentions)
+	if err != nil || len(kept) == 0 {
+		return nil, err
+	}
+
+	// Mentions are recorded for everyone so they count as unread, but only
+	// those whose notification settings allow it get the event.
+	mentioned := make([]uuid.UUID, 0, len(kept))
+	for _, mention := range kept {
+		mentioned = append(mentioned, mention.UserID)
+	}
+	settings, err := m.conversationStore.GetParticipantNotificationSettings(ctx, msg.ConversationID, mentioned)
+	if err != nil {
+		return mentioned, err
+	}
+	now := time.Now()
+
+	byKind := make(map[string][]uuid.UUID)
+	for _, mention := range kept {
+		if s, ok := settings[mention.UserID]; ok && !s.Notifies(true, now) {
+			continue
+		}
+		byKind[mention.Kind] = append(byKind[mention.Kind], mention.UserID)
+	}
+	for kind, userIDs := range byKind {
+		data, err := json.Marshal(MentionEvent{Message: *msg, Kind: kind})
+		if err != nil {
+			return mentioned, err
+		}
+		m.broadcastToUsers(userIDs, Event{Type: EventMention, Payload: data})
+	}
+	return mentioned, nil
+}
@@ -0,0 +1,111 @@
+package websockets
+
+import (
+	"context"
+	"go-chat/internals/push"
+	"go-chat/internals/store"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// maxNotificationBody bounds the message preview in a notification, in
+// characters.
+const maxNotificationBody = 200
+
+// notifyOffline hands msg to the notifier for those of recipients with no
+// client connected to any instance, as far as their notification settings
+// allow.
+func (m *Manager) notifyOffline(ctx context.Context, msg *store.Message, recipients []uuid.UUID, mentioned []uuid.UUID) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+	presence, err := m.clusterPresence(ctx, recipients)
+	if err != nil {
+		return err
+	}
+	var offline []uuid.UUID
+	for _, userID := range recipients {
+		if _, connected := presence[userID]; userID != msg.SenderID && !connected {
+			offline = append(offline, userID)
+		}
+	}
+	if len(offline) == 0 {
+		return nil
+	}
+
+	settings, err := m.conversationStore.GetParticipantNotificationSettings(ctx, msg.ConversationID, offline)
+	if err != nil {
+		return err
+	}
+	isMentioned := make(map[uuid.UUID]bool, len(mentioned))
+	for _, userID := range mentioned {
+		isMentioned[userID] = true
+	}
+	now := time.Now()
+	var notify []uuid.UUID
+	for _, userID := range offline {
+		if s, ok := settings[userID]; ok && s.Notifies(isMentioned[userID], now) {
+			notify = append(notify, userID)
+		}
+	}
+	if len(notify) == 0 {
+		return nil
+	}
+
+	title, body, err := m.describeMessage(ctx, msg)
+	if err != nil {
+		return err
+	}
+	notifications := make([]push.Notification, 0, len(notify))
+	for _, userID := range notify {
+		notifications = append(notifications, push.Notification{
+			UserID:         userID,
+			ConversationID: msg.ConversationID,
+			MessageID:      msg.ID,
+			Title:          title,
+			Body:           body,
+			Mention:        isMentioned[userID],
+		})
+	}
+	return m.notifier.Notify(ctx, notifications)
+}
+
+// describeMessage returns the title and text a notification about msg
+// shows: the sender and a preview for direct conversations, the group name
+// and the preview prefixed by the sender otherwise.
+func (m *Manager) describeMessage(ctx context.Context, msg *store.Message) (string, string, error) {
+	conversation, err := m.conversationStore.GetConversation(ctx, msg.ConversationID)
+	if err != nil {
+		return "", "", err
+	}
+	sender, err := m.userStore.GetUserById(msg.SenderID)
+	if err != nil {
+		return "", "", err
+	}
+	senderName := "Someone"
+	if sender != nil {
+		senderName = sender.UserName
+	}
+
+	preview := msg.Content
+	if preview == "" {
+		switch msg.MessageType {
+		case store.MessageTypeImage:
+			preview = "Sent a photo"
+		case store.MessageTypeVideo:
+			preview = "Sent a video"
+		default:
+			preview = "Sent a file"
+		}
+	}
+	if utf8.RuneCountInString(preview) > maxNotificationBody {
+		preview = string([]rune(preview)[:maxNotificationBody-1]) + "…"
+	}
+
+	if conversation.Type == store.ConversationTypeGroup && conversation.Name != nil {
+		return *conversation.Name, senderName + ": " + preview, nil
+	}
+	return senderName, preview, nil
+}
@@ -0,0 +1,37 @@
+package websockets
+
+import (
+	"context"
+	"go-chat/internals/store"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MessagePinned   = "pinned"
+	MessageUnpinned = "unpinned"
+)
+
+type PinUpdatedEvent struct {
+	ConversationID uuid.UUID     `json:"conversation_id"`
+	MessageID      uuid.UUID     `json:"message_id"`
+	UserID         uuid.UUID     `json:"user_id"`
+	Action         string        `json:"action"`
+	Message        store.Message `json:"message"`
+	At             time.Time     `json:"at"`
+}
+
+// BroadcastPinUpdated tells the conversation that userID pinned or unpinned
+// msg, except those who blocked userID or the message's sender, since the
+// event carries the message.
+func (m *Manager) BroadcastPinUpdated(ctx context.Context, msg *store.Message, userID uuid.UUID, action string) error {
+	return m.broadcastToConversationFrom(ctx, msg.ConversationID, []uuid.UUID{userID, msg.SenderID}, EventPinUpdated, PinUpdatedEvent{
+		ConversationID: msg.ConversationID,
+		MessageID:      msg.ID,
+		UserID:         userID,
+		Action:         action,
+		Message:        *msg,
+		At:             time.Now(),
+	})
+}
@@ -0,0 +1,217 @@
+package websockets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PresenceStatus string
+
+const (
+	PresenceOnline  PresenceStatus = "online"
+	PresenceAway    PresenceStatus = "away"
+	PresenceOffline PresenceStatus = "offline"
+)
+
+const (
+	// presenceHeartbeat is how often an instance confirms the presence of
+	// its users; presenceStaleAfter is when an instance that stopped doing
+	// so, because it crashed, no longer counts.
+	presenceHeartbeat  = 20 * time.Second
+	presenceStaleAfter = 3 * presenceHeartbeat
+)
+
+// Presence is a user's status aggregated over all of their connections.
+type Presence struct {
+	UserID   uuid.UUID      `json:"user_id"`
+	Status   PresenceStatus `json:"status"`
+	LastSeen *time.Time     `json:"last_seen_at,omitempty"`
+}
+
+type SetPresenceEvent struct {
+	Status PresenceStatus `json:"status"`
+}
+
+func SetPresenceHandler(event Event, c *Client) error {
+	var setPresence SetPresenceEvent
+	if err := json.Unmarshal(event.Payload, &setPresence); err != nil {
+		c.sendError(event.Type, "bad payload in request")
+		return fmt.Errorf("bad payload in request: %v", err)
+	}
+	if setPresence.Status != PresenceOnline && setPresence.Status != PresenceAway {
+		c.sendError(event.Type, "status must be online or away")
+		return fmt.Errorf("invalid presence status %q", setPresence.Status)
+	}
+
+	c.Manager.Lock()
+	before := c.Manager.presenceLocked(c.UserID)
+	c.presence = setPresence.Status
+	after := c.Manager.presenceLocked(c.UserID)
+	c.Manager.Unlock()
+
+	if before != after {
+		go c.Manager.publishPresence(c.UserID)
+	}
+	return nil
+}
+
+// presenceLocked aggregates the status of userID's clients on this
+// instance: online if any client is online, away if all are away, offline
+// without clients. The caller must hold the manager lock.
+func (m *Manager) presenceLocked(userID uuid.UUID) PresenceStatus {
+	status := PresenceOffline
+	for client := range m.userClients[userID] {
+		if client.presence == PresenceOnline {
+			return PresenceOnline
+		}
+		status = PresenceAway
+	}
+	return status
+}
+
+// clusterPresence returns the status of those of userIDs connected to any
+// instance. Offline users are left out.
+func (m *Manager) clusterPresence(ctx context.Context, userIDs []uuid.UUID) (map[uuid.UUID]PresenceStatus, error) {
+	stored, err := m.presenceStore.GetPresence(ctx, userIDs, presenceStaleAfter)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[uuid.UUID]PresenceStatus, len(stored))
+	for userID, status := range stored {
+		statuses[userID] = PresenceStatus(status)
+	}
+	return statuses, nil
+}
+
+// GetPresence reports userID's live status over every instance, falling
+// back to the stored last-seen time when they have no connections.
+func (m *Manager) GetPresence(ctx context.Context, userID uuid.UUID) (*Presence, error) {
+	statuses, err := m.clusterPresence(ctx, []uuid.UUID{userID})
+	if err != nil {
+		return nil, err
+	}
+	status, ok := statuses[userID]
+	if !ok {
+		status = PresenceOffline
+	}
+
+	presence := &Presence{UserID: userID, Status: status}
+	if status != PresenceOffline {
+		now := time.Now()
+		presence.LastSeen = &now
+		return presence, nil
+	}
+	user, err := m.userStore.GetUserById(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		presence.LastSeen = user.LastSeen
+	}
+	return presence, nil
+}
+
+// recordPresence stores userID's status on this instance for the others to
+// see. The status is read here, under presenceWrites, so that writes land
+// in the order the changes happened.
+func (m *Manager) recordPresence(ctx context.Context, userID uuid.UUID) error {
+	m.presenceWrites.Lock()
+	defer m.presenceWrites.Unlock()
+
+	m.RLock()
+	status := m.presenceLocked(userID)
+	m.RUnlock()
+
+	stored := string(status)
+	if status == PresenceOffline {
+		stored = ""
+	}
+	return m.presenceStore.SetInstancePresence(ctx, m.instanceID, userID, stored)
+}
+
+// publishPresence records userID's presence on this instance and pushes
+// their status over every instance to everyone sharing a conversation with
+// them, recording last-seen when they went offline everywhere.
+func (m *Manager) publishPresence(userID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+
+	if err := m.recordPresence(ctx, userID); err != nil {
+		m.logger.Println("error recording presence:", err)
+		return
+	}
+	statuses, err := m.clusterPresence(ctx, []uuid.UUID{userID})
+	if err != nil {
+		m.logger.Println("error fetching presence:", err)
+		return
+	}
+	status, ok := statuses[userID]
+	if !ok {
+		status = PresenceOffline
+	}
+
+	now := time.Now()
+	if status == PresenceOffline {
+		if err := m.userStore.UpdateLastSeen(userID, now); err != nil {
+			m.logger.Println("error updating last seen:", err)
+		}
+	}
+
+	peers, err := m.conversationStore.GetConversationPeers(ctx, userID)
+	if err != nil {
+		m.logger.Println("error fetching conversation peers:", err)
+		return
+	}
+	// Users userID has blocked don't get to see when they are around.
+	blocked, err := m.blockStore.GetBlockedIDs(ctx, userID)
+	if err != nil {
+		m.logger.Println("error fetching blocked users:", err)
+		return
+	}
+	peers = excludeUsers(peers, blocked)
+	data, err := json.Marshal(Presence{UserID: userID, Status: status, LastSeen: &now})
+	if err != nil {
+		m.logger.Println("error marshalling presence:", err)
+		return
+	}
+	m.broadcastToUsers(peers, Event{Type: EventPresence, Payload: data})
+}
+
+// RunPresenceHeartbeat rewrites the presence of every user connected to
+// this instance every presenceHeartbeat until ctx is done, so the other
+// instances keep counting them, and clears out instances that stopped.
+func (m *Manager) RunPresenceHeartbeat(ctx context.Context) {
+	ticker := time.NewTicker(presenceHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.syncPresence(ctx); err != nil {
+				m.logger.Println("error syncing presence:", err)
+			}
+		}
+	}
+}
+
+func (m *Manager) syncPresence(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, eventTimeout)
+	defer cancel()
+
+	m.presenceWrites.Lock()
+	defer m.presenceWrites.Unlock()
+
+	m.RLock()
+	statuses := make(map[uuid.UUID]string, len(m.userClients))
+	for userID := range m.userClients {
+		statuses[userID] = string(m.presenceLocked(userID))
+	}
+	m.RUnlock()
+
+	return m.presenceStore.SyncInstancePresence(ctx, m.instanceID, statuses, presenceStaleAfter)
+}
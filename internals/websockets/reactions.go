@@ -0,0 +1,81 @@
+package websockets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-chat/internals/store"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ReactionAdded   = "added"
+	ReactionRemoved = "removed"
+)
+
+type ReactEvent struct {
+	MessageID uuid.UUID `json:"message_id"`
+	Emoji     string    `json:"emoji"`
+}
+
+// ReactionUpdatedEvent carries the change that happened and the message's
+// full reaction state after it.
+type ReactionUpdatedEvent struct {
+	MessageID      uuid.UUID               `json:"message_id"`
+	ConversationID uuid.UUID               `json:"conversation_id"`
+	UserID         uuid.UUID               `json:"user_id"`
+	Emoji          string                  `json:"emoji"`
+	Action         string                  `json:"action"`
+	Reactions      []store.ReactionSummary `json:"reactions"`
+}
+
+func ReactHandler(event Event, c *Client) error {
+	return handleReaction(event, c, ReactionAdded)
+}
+
+func UnreactHandler(event Event, c *Client) error {
+	return handleReaction(event, c, ReactionRemoved)
+}
+
+func handleReaction(event Event, c *Client, action string) error {
+	var reactEvent ReactEvent
+	if err := json.Unmarshal(event.Payload, &reactEvent); err != nil {
+		c.sendError(event.Type, "bad payload in request")
+		return fmt.Errorf("bad payload in request: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+
+	var (
+		msg *store.Message
+		err error
+	)
+	if action == ReactionAdded {
+		msg, err = c.Manager.messageStore.AddReaction(ctx, reactEvent.MessageID, c.UserID, reactEvent.Emoji)
+	} else {
+		msg, err = c.Manager.messageStore.RemoveReaction(ctx, reactEvent.MessageID, c.UserID, reactEvent.Emoji)
+	}
+	if err != nil {
+		return c.reportError(event.Type, err)
+	}
+	return c.Manager.BroadcastReactionUpdated(ctx, msg, c.UserID, reactEvent.Emoji, action)
+}
+
+// BroadcastReactionUpdated tells the conversation about userID's reaction,
+// except those who blocked userID or the message's sender.
+func (m *Manager) BroadcastReactionUpdated(ctx context.Context, msg *store.Message, userID uuid.UUID, emoji string, action string) error {
+	reactions := msg.Reactions
+	if reactions == nil {
+		reactions = []store.ReactionSummary{}
+	}
+	return m.broadcastToConversationFrom(ctx, msg.ConversationID, []uuid.UUID{userID, msg.SenderID}, EventReactionUpdated, ReactionUpdatedEvent{
+		MessageID:      msg.ID,
+		ConversationID: msg.ConversationID,
+		UserID:         userID,
+		Emoji:          emoji,
+		Action:         action,
+		Reactions:      reactions,
+	})
+}
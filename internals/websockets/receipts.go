@@ -0,0 +1,117 @@
+package websockets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-chat/internals/store"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type MarkReadEvent struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+}
+
+// MessageStatusEvent tells a sender that one recipient moved some of their
+// messages to a new status.
+type MessageStatusEvent struct {
+	ConversationID uuid.UUID               `json:"conversation_id"`
+	UserID         uuid.UUID               `json:"user_id"`
+	Status         store.MessageStatusType `json:"status"`
+	MessageIDs     []uuid.UUID             `json:"message_ids"`
+	Timestamp      time.Time               `json:"timestamp"`
+}
+
+func MarkReadHandler(event Event, c *Client) error {
+	var markRead MarkReadEvent
+	if err := json.Unmarshal(event.Payload, &markRead); err != nil {
+		c.sendError(event.Type, "bad payload in request")
+		return fmt.Errorf("bad payload in request: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+
+	ok, err := c.Manager.conversationStore.IsParticipant(ctx, markRead.ConversationID, c.UserID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		c.sendError(event.Type, "you are not a participant of this conversation")
+		return fmt.Errorf("user %s denied access to conversation %s", c.UserID, markRead.ConversationID)
+	}
+
+	changes, err := c.Manager.messageStore.MarkMessagesAsRead(ctx, c.UserID, markRead.ConversationID)
+	if err != nil {
+		return err
+	}
+	c.Manager.notifyStatusChanges(changes)
+	return nil
+}
+
+// markDelivered records delivery of msg to every recipient that had it queued
+// on a live client and lets the sender know.
+func (m *Manager) markDelivered(msg *store.Message, reached []uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+
+	var changes []store.StatusChange
+	for _, userID := range reached {
+		if userID == msg.SenderID {
+			continue
+		}
+		change, err := m.messageStore.UpdateMessageStatus(ctx, msg.ID, userID, store.MessageStatusDelivered)
+		if err != nil {
+			m.logger.Println("error marking message delivered:", err)
+			continue
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+	m.notifyStatusChanges(changes)
+}
+
+// notifyStatusChanges pushes message_status events to the senders of the
+// affected messages and to the recipient's own devices, one event per
+// sender, recipient and status.
+func (m *Manager) notifyStatusChanges(changes []store.StatusChange) {
+	type key struct {
+		senderID uuid.UUID
+		userID   uuid.UUID
+		status   store.MessageStatusType
+	}
+	grouped := make(map[key]*MessageStatusEvent)
+	var order []key
+	for _, change := range changes {
+		k := key{change.SenderID, change.UserID, change.Status}
+		statusEvent, ok := grouped[k]
+		if !ok {
+			statusEvent = &MessageStatusEvent{
+				ConversationID: change.ConversationID,
+				UserID:         change.UserID,
+				Status:         change.Status,
+			}
+			grouped[k] = statusEvent
+			order = append(order, k)
+		}
+		statusEvent.MessageIDs = append(statusEvent.MessageIDs, change.MessageID)
+		if change.Timestamp.After(statusEvent.Timestamp) {
+			statusEvent.Timestamp = change.Timestamp
+		}
+	}
+
+	for _, k := range order {
+		data, err := json.Marshal(grouped[k])
+		if err != nil {
+			m.logger.Println("error marshalling message status:", err)
+			continue
+		}
+		m.broadcastToUsers([]uuid.UUID{k.senderID, k.userID}, Event{
+			Type:    EventMessageStatus,
+			Payload: data,
+		})
+	}
+}
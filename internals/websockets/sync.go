@@ -0,0 +1,60 @@
+package websockets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-chat/internals/store"
+)
+
+const (
+	defaultSyncLimit = 200
+	maxSyncLimit     = 500
+)
+
+type SyncEvent struct {
+	Since string `json:"since"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+// SyncHandler answers a reconnecting client with everything that changed in
+// its conversations since the cursor it last saw. Clients keep calling sync
+// with the returned cursor while has_more is set.
+func SyncHandler(event Event, c *Client) error {
+	var syncEvent SyncEvent
+	if err := json.Unmarshal(event.Payload, &syncEvent); err != nil {
+		c.sendError(event.Type, "bad payload in request")
+		return fmt.Errorf("bad payload in request: %v", err)
+	}
+
+	var since store.SyncCursor
+	if syncEvent.Since != "" {
+		var err error
+		since, err = store.DecodeSyncCursor(syncEvent.Since)
+		if err != nil {
+			c.sendError(event.Type, err.Error())
+			return err
+		}
+	}
+	limit := syncEvent.Limit
+	if limit <= 0 {
+		limit = defaultSyncLimit
+	}
+	if limit > maxSyncLimit {
+		limit = maxSyncLimit
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+
+	result, err := c.Manager.syncStore.GetChangesSince(ctx, c.UserID, since, limit)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	c.send(Event{Type: EventSync, Payload: data})
+	return nil
+}
@@ -0,0 +1,158 @@
+package websockets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-chat/internals/store"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ThreadEvent struct {
+	MessageID uuid.UUID `json:"message_id"`
+}
+
+// ThreadUpdatedEvent tells every participant that a thread grew, without
+// sending them the reply itself.
+type ThreadUpdatedEvent struct {
+	RootMessageID  uuid.UUID  `json:"root_message_id"`
+	ConversationID uuid.UUID  `json:"conversation_id"`
+	ReplyID        uuid.UUID  `json:"reply_id"`
+	SenderID       uuid.UUID  `json:"sender_id"`
+	ReplyCount     int        `json:"reply_count"`
+	LastReplyAt    *time.Time `json:"last_reply_at"`
+}
+
+// FollowThreadHandler subscribes the client to the replies of a thread. Any
+// message of the thread may be given; the client follows its root.
+func FollowThreadHandler(event Event, c *Client) error {
+	root, err := c.threadRoot(event)
+	if err != nil {
+		return err
+	}
+	c.Manager.Lock()
+	c.threads[root.ID] = true
+	c.Manager.Unlock()
+	return nil
+}
+
+// UnfollowThreadHandler stops sending the client the replies of a thread.
+// Like following, any message of the thread may be given.
+func UnfollowThreadHandler(event Event, c *Client) error {
+	threadEvent, err := c.decodeThreadEvent(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+
+	rootID := threadEvent.MessageID
+	msg, err := c.Manager.messageStore.GetMessageByID(ctx, threadEvent.MessageID)
+	switch {
+	case errors.Is(err, store.ErrMessageNotFound):
+		// Gone since it was followed: forget it under the ID given.
+	case err != nil:
+		return err
+	case msg.ThreadRootID != nil:
+		rootID = *msg.ThreadRootID
+	}
+	c.Manager.Lock()
+	delete(c.threads, rootID)
+	c.Manager.Unlock()
+	return nil
+}
+
+func MarkThreadReadHandler(event Event, c *Client) error {
+	root, err := c.threadRoot(event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+	if err := c.Manager.messageStore.MarkThreadRead(ctx, root.ID, c.UserID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// threadRoot resolves the message named in a thread event to the root of
+// its thread, checking the client may see it.
+func (c *Client) threadRoot(event Event) (*store.Message, error) {
+	threadEvent, err := c.decodeThreadEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+
+	msg, err := c.Manager.messageStore.GetVisibleMessageByID(ctx, threadEvent.MessageID, c.UserID)
+	if err != nil {
+		return nil, c.reportError(event.Type, err)
+	}
+	if msg.ThreadRootID != nil {
+		msg, err = c.Manager.messageStore.GetVisibleMessageByID(ctx, *msg.ThreadRootID, c.UserID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ok, err := c.Manager.conversationStore.IsParticipant(ctx, msg.ConversationID, c.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, c.reportError(event.Type, store.ErrNotParticipant)
+	}
+	return msg, nil
+}
+
+func (c *Client) decodeThreadEvent(event Event) (ThreadEvent, error) {
+	var threadEvent ThreadEvent
+	if err := json.Unmarshal(event.Payload, &threadEvent); err != nil {
+		c.sendError(event.Type, "bad payload in request")
+		return threadEvent, fmt.Errorf("bad payload in request: %v", err)
+	}
+	return threadEvent, nil
+}
+
+// broadcastThreadReply sends a new reply to the clients following its thread
+// and a thread_updated summary to every participant. The sending client
+// follows the thread from then on.
+func (m *Manager) broadcastThreadReply(ctx context.Context, c *Client, reply *store.Message, participants []uuid.UUID) error {
+	root, err := m.messageStore.GetMessageByID(ctx, *reply.ThreadRootID)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	c.threads[root.ID] = true
+	m.Unlock()
+
+	data, err := json.Marshal(NewMessageEvent{Message: *reply})
+	if err != nil {
+		return err
+	}
+	m.publish(brokerEnvelope{
+		UserIDs:  participants,
+		ThreadID: &root.ID,
+		Event:    Event{Type: EventThreadReply, Payload: data},
+	})
+
+	data, err = json.Marshal(ThreadUpdatedEvent{
+		RootMessageID:  root.ID,
+		ConversationID: root.ConversationID,
+		ReplyID:        reply.ID,
+		SenderID:       reply.SenderID,
+		ReplyCount:     root.ReplyCount,
+		LastReplyAt:    root.LastReplyAt,
+	})
+	if err != nil {
+		return err
+	}
+	m.broadcastToUsers(participants, Event{Type: EventThreadUpdated, Payload: data})
+	return nil
+}
@@ -0,0 +1,155 @@
+package websockets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// typingTimeout is how long a typing indicator lives without another
+// typing_start. Clients are expected to repeat typing_start every few
+// seconds while the user keeps typing.
+var typingTimeout = 6 * time.Second
+
+type TypingEvent struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	UserID         uuid.UUID `json:"user_id,omitempty"`
+}
+
+type typingKey struct {
+	conversationID uuid.UUID
+	userID         uuid.UUID
+}
+
+// typingTracker remembers who is typing where, so indicators can be expired
+// when a client goes quiet without sending typing_stop.
+type typingTracker struct {
+	sync.Mutex
+	timers map[typingKey]*time.Timer
+}
+
+func newTypingTracker() *typingTracker {
+	return &typingTracker{timers: make(map[typingKey]*time.Timer)}
+}
+
+// start (re)arms the expiry timer and reports whether the user was not
+// already typing in the conversation. Every call arms a new timer: one that
+// already fired may be waiting for the lock, and finding itself replaced
+// tells it not to expire the indicator.
+func (t *typingTracker) start(key typingKey, expire func()) bool {
+	t.Lock()
+	defer t.Unlock()
+	previous, typing := t.timers[key]
+	if typing {
+		previous.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(typingTimeout, func() {
+		t.Lock()
+		if t.timers[key] != timer {
+			t.Unlock()
+			return
+		}
+		delete(t.timers, key)
+		t.Unlock()
+		expire()
+	})
+	t.timers[key] = timer
+	return !typing
+}
+
+// stop clears the indicator and reports whether the user was typing.
+func (t *typingTracker) stop(key typingKey) bool {
+	t.Lock()
+	defer t.Unlock()
+	timer, ok := t.timers[key]
+	if !ok {
+		return false
+	}
+	timer.Stop()
+	delete(t.timers, key)
+	return true
+}
+
+func TypingStartHandler(event Event, c *Client) error {
+	return handleTyping(event, c, true)
+}
+
+func TypingStopHandler(event Event, c *Client) error {
+	return handleTyping(event, c, false)
+}
+
+func handleTyping(event Event, c *Client, typing bool) error {
+	var typingEvent TypingEvent
+	if err := json.Unmarshal(event.Payload, &typingEvent); err != nil {
+		c.sendError(event.Type, "bad payload in request")
+		return fmt.Errorf("bad payload in request: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventTimeout)
+	defer cancel()
+
+	participants, err := c.Manager.conversationStore.GetConversationParticipants(ctx, typingEvent.ConversationID)
+	if err != nil {
+		return err
+	}
+	if !containsUser(participants, c.UserID) {
+		c.sendError(event.Type, "you are not a participant of this conversation")
+		return fmt.Errorf("user %s denied access to conversation %s", c.UserID, typingEvent.ConversationID)
+	}
+	participants, err = c.Manager.withoutBlockers(ctx, c.UserID, participants)
+	if err != nil {
+		return err
+	}
+
+	key := typingKey{conversationID: typingEvent.ConversationID, userID: c.UserID}
+	if typing {
+		started := c.Manager.typing.start(key, func() {
+			c.Manager.broadcastTyping(EventTypingStop, key, participants)
+		})
+		if started {
+			c.Manager.broadcastTyping(EventTypingStart, key, participants)
+		}
+		return nil
+	}
+	if c.Manager.typing.stop(key) {
+		c.Manager.broadcastTyping(EventTypingStop, key, participants)
+	}
+	return nil
+}
+
+// stopTyping clears a typing indicator, e.g. once the user's message is sent.
+func (m *Manager) stopTyping(conversationID, userID uuid.UUID, participants []uuid.UUID) {
+	key := typingKey{conversationID: conversationID, userID: userID}
+	if m.typing.stop(key) {
+		m.broadcastTyping(EventTypingStop, key, participants)
+	}
+}
+
+func (m *Manager) broadcastTyping(eventType string, key typingKey, participants []uuid.UUID) {
+	data, err := json.Marshal(TypingEvent{ConversationID: key.conversationID, UserID: key.userID})
+	if err != nil {
+		m.logger.Println("error marshalling typing event:", err)
+		return
+	}
+	others := make([]uuid.UUID, 0, len(participants))
+	for _, id := range participants {
+		if id != key.userID {
+			others = append(others, id)
+		}
+	}
+	m.broadcastToUsers(others, Event{Type: eventType, Payload: data})
+}
+
+func containsUser(userIDs []uuid.UUID, userID uuid.UUID) bool {
+	for _, id := range userIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -21,6 +21,7 @@ func main() {
 
 	r := routes.SetupRoutes(app)
 	defer app.DB.Close()
+	defer app.Broker.Close()
 	app.Logger.Println("first log from main.go")
 	server := &http.Server{
 		Addr:         ":9000",
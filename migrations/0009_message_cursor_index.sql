@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Cursor pagination orders by (created_at, id); include id so the
+-- row comparison and ORDER BY are served straight from the index
+DROP INDEX IF EXISTS idx_messages_conversation_time;
+CREATE INDEX idx_messages_conversation_time
+    ON messages(conversation_id, created_at DESC, id DESC);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_messages_conversation_time;
+CREATE INDEX idx_messages_conversation_time
+    ON messages(conversation_id, created_at DESC);
+-- +goose StatementEnd
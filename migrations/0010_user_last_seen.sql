@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Last time the user had a live connection
+-- NULL means the user has never connected
+ALTER TABLE users ADD COLUMN last_seen_at TIMESTAMP WITH TIME ZONE;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS last_seen_at;
+-- +goose StatementEnd
@@ -0,0 +1,64 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Every change inside a conversation (new message, status change,
+-- membership change) takes the next number from last_seq
+-- WHY: gives reconnecting clients an exact per-conversation cursor
+-- instead of guessing with timestamps
+ALTER TABLE conversations ADD COLUMN last_seq BIGINT NOT NULL DEFAULT 0;
+
+-- seq: position of the message in its conversation, never changes
+-- change_seq: seq of the last change to the message (edit, delete...)
+ALTER TABLE messages ADD COLUMN seq BIGINT;
+ALTER TABLE messages ADD COLUMN change_seq BIGINT;
+
+UPDATE messages m
+SET seq = numbered.rn, change_seq = numbered.rn
+FROM (
+    SELECT id, ROW_NUMBER() OVER (
+        PARTITION BY conversation_id ORDER BY created_at, id
+    ) AS rn
+    FROM messages
+) numbered
+WHERE m.id = numbered.id;
+
+UPDATE conversations c
+SET last_seq = COALESCE(
+    (SELECT MAX(seq) FROM messages m WHERE m.conversation_id = c.id), 0
+);
+
+ALTER TABLE messages ALTER COLUMN seq SET NOT NULL;
+ALTER TABLE messages ALTER COLUMN change_seq SET NOT NULL;
+
+-- Denormalized so status changes can be synced per conversation
+ALTER TABLE message_status ADD COLUMN conversation_id UUID REFERENCES conversations(id) ON DELETE CASCADE;
+UPDATE message_status ms
+SET conversation_id = m.conversation_id
+FROM messages m
+WHERE m.id = ms.message_id;
+ALTER TABLE message_status ALTER COLUMN conversation_id SET NOT NULL;
+ALTER TABLE message_status ADD COLUMN seq BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE conversation_participants ADD COLUMN seq BIGINT NOT NULL DEFAULT 0;
+
+CREATE UNIQUE INDEX idx_messages_conversation_seq
+    ON messages(conversation_id, seq);
+CREATE INDEX idx_messages_conversation_change_seq
+    ON messages(conversation_id, change_seq);
+CREATE INDEX idx_message_status_conversation_seq
+    ON message_status(conversation_id, seq);
+CREATE INDEX idx_participants_conversation_seq
+    ON conversation_participants(conversation_id, seq);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_participants_conversation_seq;
+DROP INDEX IF EXISTS idx_message_status_conversation_seq;
+DROP INDEX IF EXISTS idx_messages_conversation_change_seq;
+DROP INDEX IF EXISTS idx_messages_conversation_seq;
+ALTER TABLE conversation_participants DROP COLUMN IF EXISTS seq;
+ALTER TABLE message_status DROP COLUMN IF EXISTS seq;
+ALTER TABLE message_status DROP COLUMN IF EXISTS conversation_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS change_seq;
+ALTER TABLE messages DROP COLUMN IF EXISTS seq;
+ALTER TABLE conversations DROP COLUMN IF EXISTS last_seq;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE message_revisions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+
+    -- Content of the message before the edit
+    content TEXT,
+
+    -- When this version was replaced
+    edited_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Show the edit history of a message, oldest first
+CREATE INDEX idx_message_revisions_message
+    ON message_revisions(message_id, edited_at);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS message_revisions;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- "Delete for me": the message stays for everyone else
+-- but is no longer shown to this user
+CREATE TABLE message_hidden (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    hidden_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id)
+);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS message_hidden;
+-- +goose StatementEnd
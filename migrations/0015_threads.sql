@@ -0,0 +1,57 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Replies form flat threads under the first message of the chain
+-- reply_to_message_id still says which message was quoted
+-- thread_root_id says which thread the reply is filed under
+ALTER TABLE messages ADD COLUMN thread_root_id UUID REFERENCES messages(id) ON DELETE SET NULL;
+
+-- Kept on the root message so the timeline can show "3 replies" cheaply
+ALTER TABLE messages ADD COLUMN reply_count INT NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN last_reply_at TIMESTAMP WITH TIME ZONE;
+
+-- Existing reply chains are filed under the message they started from
+WITH RECURSIVE chain AS (
+    SELECT id, id AS root_id
+    FROM messages
+    WHERE reply_to_message_id IS NULL
+    UNION ALL
+    SELECT m.id, chain.root_id
+    FROM messages m
+    JOIN chain ON m.reply_to_message_id = chain.id
+)
+UPDATE messages
+SET thread_root_id = chain.root_id
+FROM chain
+WHERE messages.id = chain.id AND chain.id != chain.root_id;
+
+UPDATE messages root
+SET reply_count = replies.count, last_reply_at = replies.last_reply_at
+FROM (
+    SELECT thread_root_id, COUNT(*) AS count, MAX(created_at) AS last_reply_at
+    FROM messages
+    WHERE thread_root_id IS NOT NULL
+    GROUP BY thread_root_id
+) replies
+WHERE root.id = replies.thread_root_id;
+
+CREATE INDEX idx_messages_thread_time
+    ON messages(thread_root_id, created_at, id)
+    WHERE thread_root_id IS NOT NULL;
+
+-- How far each user has read in each thread
+-- Thread replies don't get message_status rows, this replaces them
+CREATE TABLE thread_reads (
+    root_message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_read_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (root_message_id, user_id)
+);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS thread_reads;
+DROP INDEX IF EXISTS idx_messages_thread_time;
+ALTER TABLE messages DROP COLUMN IF EXISTS last_reply_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS reply_count;
+ALTER TABLE messages DROP COLUMN IF EXISTS thread_root_id;
+-- +goose StatementEnd
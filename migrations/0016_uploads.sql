@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE uploads (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+
+    -- Only the uploader may attach the file to a message
+    uploader_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- Where the bytes live in the blob store, e.g. "uploads/<id>"
+    storage_key TEXT NOT NULL,
+
+    -- Name the client gave the file, used when downloading it
+    file_name VARCHAR(255) NOT NULL,
+
+    -- Sniffed from the content, not taken from the client
+    mime_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+
+    -- Set once the upload is sent; downloads are then allowed to the
+    -- participants of the message's conversation
+    -- An upload can only ever be attached to one message
+    message_id UUID UNIQUE REFERENCES messages(id) ON DELETE SET NULL,
+
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS uploads;
+-- +goose StatementEnd
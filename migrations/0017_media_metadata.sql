@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Pixel dimensions of images, so clients can lay out the message before
+-- the image has loaded
+ALTER TABLE uploads ADD COLUMN width INT;
+ALTER TABLE uploads ADD COLUMN height INT;
+
+-- Resized copies of images, e.g.
+-- [{"name": "small", "url": "/uploads/<id>/thumbnails/small", "width": 320, "height": 240, "mime_type": "image/jpeg"}]
+-- NULL for files that aren't images
+ALTER TABLE uploads ADD COLUMN thumbnails JSONB;
+
+-- Copied from the upload when it is sent, like media_url and media_size
+ALTER TABLE messages ADD COLUMN media_width INT;
+ALTER TABLE messages ADD COLUMN media_height INT;
+ALTER TABLE messages ADD COLUMN media_thumbnails JSONB;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE messages DROP COLUMN IF EXISTS media_thumbnails;
+ALTER TABLE messages DROP COLUMN IF EXISTS media_height;
+ALTER TABLE messages DROP COLUMN IF EXISTS media_width;
+ALTER TABLE uploads DROP COLUMN IF EXISTS thumbnails;
+ALTER TABLE uploads DROP COLUMN IF EXISTS height;
+ALTER TABLE uploads DROP COLUMN IF EXISTS width;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Uploads sent in chunks over several requests
+-- The session id becomes the upload id once every byte has arrived
+CREATE TABLE upload_sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    uploader_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    file_name VARCHAR(255) NOT NULL,
+
+    -- Total size announced by the client
+    upload_length BIGINT NOT NULL CHECK (upload_length > 0),
+
+    -- How many bytes have been received so far
+    -- The next chunk must start exactly here
+    upload_offset BIGINT NOT NULL DEFAULT 0 CHECK (upload_offset <= upload_length),
+
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+    -- Pushed back by every chunk; sessions left idle past it are abandoned
+    -- and cleaned up
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_upload_sessions_expires ON upload_sessions(expires_at);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS upload_sessions;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Search vector kept up to date by Postgres on every insert and edit
+-- 'simple' does no stemming or stop words, so it behaves the same for
+-- every language users write in
+-- Content scrubbed by delete for everyone leaves an empty vector
+ALTER TABLE messages ADD COLUMN content_tsv tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', COALESCE(content, ''))) STORED;
+
+CREATE INDEX idx_messages_content_tsv ON messages USING GIN (content_tsv);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_messages_content_tsv;
+ALTER TABLE messages DROP COLUMN IF EXISTS content_tsv;
+-- +goose StatementEnd
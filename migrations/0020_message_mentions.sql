@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Users mentioned in a message, through @username, @all or @here
+-- Whether a mention is still unread follows the message's own read state
+CREATE TABLE message_mentions (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- 'user' for @username, 'all' or 'here' for group-wide mentions
+    -- WHY: Clients can highlight direct mentions more than group-wide ones
+    kind VARCHAR(10) NOT NULL DEFAULT 'user'
+        CHECK (kind IN ('user', 'all', 'here')),
+
+    PRIMARY KEY (message_id, user_id)
+);
+
+CREATE INDEX idx_message_mentions_user ON message_mentions(user_id, message_id);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS message_mentions;
+-- +goose StatementEnd
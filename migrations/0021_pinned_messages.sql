@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE pinned_messages (
+    -- A message is pinned at most once
+    message_id UUID PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+
+    -- Denormalized from messages so a conversation's pins can be listed
+    -- and counted without a join
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+
+    pinned_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    pinned_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_pinned_messages_conversation ON pinned_messages(conversation_id, pinned_at DESC);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS pinned_messages;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+-- System messages record group changes (members added or removed, roles,
+-- renames) in the conversation itself
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_message_type_check;
+ALTER TABLE messages ADD CONSTRAINT messages_message_type_check
+    CHECK (message_type IN ('text', 'image', 'video', 'file', 'system'));
+
+-- What a system message records, e.g.
+-- {"action": "members_added", "actor_id": "...", "user_ids": ["..."]}
+-- NULL for messages sent by users
+ALTER TABLE messages ADD COLUMN system_event JSONB;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM messages WHERE message_type = 'system';
+ALTER TABLE messages DROP COLUMN IF EXISTS system_event;
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_message_type_check;
+ALTER TABLE messages ADD CONSTRAINT messages_message_type_check
+    CHECK (message_type IN ('text', 'image', 'video', 'file'));
+-- +goose StatementEnd
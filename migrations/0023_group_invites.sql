@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE conversation_invites (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+
+    -- Random code put in the shared link; stored as is so admins can
+    -- copy it again from the invite list
+    code VARCHAR(32) NOT NULL UNIQUE,
+
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+
+    -- NULL: never expires / no use limit
+    expires_at TIMESTAMP WITH TIME ZONE,
+    max_uses INTEGER CHECK (max_uses > 0),
+    use_count INTEGER NOT NULL DEFAULT 0,
+
+    -- Joining through the link only asks an admin to let the user in
+    requires_approval BOOLEAN NOT NULL DEFAULT FALSE,
+
+    -- Revoked invites are kept so a stale link reports "revoked" rather
+    -- than "not found"
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_conversation_invites_conversation
+    ON conversation_invites(conversation_id, created_at DESC);
+
+-- Pending requests to join through an invite that requires approval.
+-- Rows are deleted once an admin approves or rejects them
+CREATE TABLE conversation_join_requests (
+    conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    invite_id UUID REFERENCES conversation_invites(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (conversation_id, user_id)
+);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS conversation_join_requests;
+DROP TABLE IF EXISTS conversation_invites;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Per-participant notification preferences
+-- all: every message notifies
+-- mentions: only messages mentioning the participant do
+-- none: nothing does
+-- Unread counts are kept whatever the setting
+ALTER TABLE conversation_participants ADD COLUMN notification_level VARCHAR(10) NOT NULL DEFAULT 'all'
+    CHECK (notification_level IN ('all', 'mentions', 'none'));
+
+-- Silences the conversation entirely until then, whatever the level
+ALTER TABLE conversation_participants ADD COLUMN muted_until TIMESTAMP WITH TIME ZONE;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE conversation_participants DROP COLUMN IF EXISTS muted_until;
+ALTER TABLE conversation_participants DROP COLUMN IF EXISTS notification_level;
+-- +goose StatementEnd
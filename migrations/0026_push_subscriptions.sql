@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Web Push subscriptions, one per browser or device a user allowed
+-- notifications on
+CREATE TABLE push_subscriptions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+
+    -- Push service URL identifying the device; re-registering it (e.g.
+    -- after another user logs in on the same browser) moves it over
+    endpoint TEXT NOT NULL UNIQUE,
+
+    -- Keys the payload is encrypted with (RFC 8291), base64url
+    p256dh VARCHAR(100) NOT NULL,
+    auth VARCHAR(50) NOT NULL,
+
+    user_agent VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_push_subscriptions_user ON push_subscriptions(user_id);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS push_subscriptions;
+-- +goose StatementEnd
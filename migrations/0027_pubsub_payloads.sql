@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Broker payloads too large for a NOTIFY. The notification carries only the
+-- id; rows are pruned once every listener has had time to read them.
+CREATE TABLE pubsub_payloads (
+    id BIGSERIAL PRIMARY KEY,
+    payload BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_pubsub_payloads_created ON pubsub_payloads(created_at);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS pubsub_payloads;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Live presence of users across every server instance: each instance keeps
+-- one row per user connected to it, refreshed by a heartbeat. Rows of an
+-- instance that stopped heartbeating are ignored and eventually removed.
+CREATE TABLE user_presence (
+    instance_id UUID NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(10) NOT NULL CHECK (status IN ('online', 'away')),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (instance_id, user_id)
+);
+
+CREATE INDEX idx_user_presence_user ON user_presence(user_id);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_presence;
+-- +goose StatementEnd
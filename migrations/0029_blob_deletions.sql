@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Blob store keys of files whose uploads are gone, waiting to be removed
+-- from the blob store by the upload janitor
+CREATE TABLE blob_deletions (
+    storage_key TEXT PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS blob_deletions;
+-- +goose StatementEnd